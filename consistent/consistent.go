@@ -1,12 +1,15 @@
 package consistent
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"math"
-	"sort"
+	"math/bits"
+	"math/rand"
 	"sync"
+	"time"
 )
 
 // base on https://research.googleblog.com/2017/04/consistent-hashing-with-bounded-loads.html
@@ -18,21 +21,150 @@ const (
 	DefaultLoad              float64 = 1.25
 )
 
-var ErrInsufficientMemberCount = errors.New("insufficient member count")
+var (
+	ErrInsufficientMemberCount = errors.New("insufficient member count")
+	ErrCorruptRing             = errors.New("corrupt ring")
+	ErrNilHashFunc             = errors.New("HashFunc cannot be nil")
+	ErrInvalidConfig           = errors.New("invalid config")
+	ErrMemberNotFound          = errors.New("member not found")
+	ErrNoHealthyMember         = errors.New("no healthy member")
+	ErrInvalidPartitionTable   = errors.New("invalid partition table")
+	ErrInvalidPartition        = errors.New("invalid partition ID")
+)
+
+// DistributionError is the panic value raised when the partitions do not fit
+// under the members' load caps.
+type DistributionError struct {
+	Members    int
+	Partitions int
+	Load       float64
+	Cap        float64
+}
+
+func (e *DistributionError) Error() string {
+	return fmt.Sprintf("not enough room to distribute partitions: %d partitions over %d members "+
+		"with load %.2f (cap %.0f per member); increase the load factor or member count, "+
+		"or decrease the partition count", e.Partitions, e.Members, e.Load, e.Cap)
+}
 
 type HashFunc interface {
 	Sum64([]byte) uint64
 }
 
+// seededHash mixes a seed into every hash by passing the hash xor the seed
+// through the splitmix64 finalizer, a bijection, so placements stay as
+// uniform as with the plain hash.
+type seededHash struct {
+	h    HashFunc
+	seed uint64
+}
+
+func (s seededHash) Sum64(data []byte) uint64 {
+	z := s.h.Sum64(data) ^ s.seed
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
 type Member interface {
 	String() string
 }
 
+// WeightedMember is a Member with a relative capacity. A member of weight 2
+// gets twice as many ring points and twice the load cap of a member of
+// weight 1. Members that do not implement WeightedMember, or report a weight
+// below 1, have weight 1.
+type WeightedMember interface {
+	Member
+	Weight() int
+}
+
+// FractionalWeightedMember is a WeightedMember whose weight need not be an
+// integer. It gets round(ReplicationFactor * weight) ring points, while its
+// load cap scales with the exact weight. Weights below 1 count as 1.
+type FractionalWeightedMember interface {
+	Member
+	Weight() float64
+}
+
+func weightOf(member Member) float64 {
+	switch wm := member.(type) {
+	case WeightedMember:
+		if wm.Weight() > 1 {
+			return float64(wm.Weight())
+		}
+	case FractionalWeightedMember:
+		if wm.Weight() > 1 {
+			return wm.Weight()
+		}
+	}
+	return 1
+}
+
+// pointCount is the number of ring points of member.
+func (c *Consistent) pointCount(member Member) int {
+	return int(math.Round(float64(c.config.ReplicationFactor) * weightOf(member)))
+}
+
+// PartitionMapping selects how a key hash is reduced to a partition ID.
+type PartitionMapping int
+
+const (
+	// Modulo maps a hash to hash % PartitionCount. It is the default.
+	Modulo PartitionMapping = iota
+	// MultiplyShift maps a hash to (hash * PartitionCount) >> 64 (Lemire's
+	// reduction), which avoids the modulo bias for uniform 64-bit hashes.
+	// It uses the high bits of the hash, so HashFunc must mix them well.
+	MultiplyShift
+)
+
 type Config struct {
 	HashFunc          HashFunc
 	PartitionCount    int
 	ReplicationFactor int
 	Load              float64
+	PartitionMapping  PartitionMapping
+	// ExpectedMembers is an optional hint used by New to presize the ring.
+	ExpectedMembers int
+	// Strategy assigns partitions to members. It defaults to BoundedLoad.
+	Strategy DistributionStrategy
+	// Rand is the source of randomness for randomized strategies, available
+	// to them as RingView.Rand. TwoChoices uses it to break load ties; the
+	// deterministic BoundedLoad and Unbounded ignore it. Seed it for
+	// reproducible tests, or back it with a crypto/rand Source in production.
+	// It is only used while the ring's write lock is held, but must not be
+	// shared with other code. Simulations such as KeysMovedBetween run
+	// without it.
+	Rand *rand.Rand
+	// DisableBoundedLoad selects the Unbounded strategy, i.e. classic
+	// consistent hashing, for compatibility with other implementations. It
+	// cannot be combined with Strategy.
+	DisableBoundedLoad bool
+	// PrecomputeReplicas, if positive, makes every rebalance store that many
+	// closest members per partition for GetPartitionReplicas.
+	PrecomputeReplicas int
+	// RingImpl selects the ring point data structure. It defaults to
+	// SliceRing.
+	RingImpl RingImpl
+	// HistorySize, if positive, keeps a Snapshot of the partition table after
+	// each of the last HistorySize rebalances, for LocateKeyAt. Snapshots
+	// share tables with the ring, so each costs one partition table (about
+	// 50 bytes per partition) and keeps removed members reachable.
+	HistorySize int
+	// MigrationWindow, if positive, makes every rebalance remember the
+	// previous owner of each moved partition for that long, for
+	// GetPartitionOwnersDuringMigration.
+	MigrationWindow time.Duration
+	// DefaultReplicaCount is the number of members GetReplicas returns.
+	DefaultReplicaCount int
+	// Now is the clock used for TTL expiry, migration windows and snapshot
+	// times. It defaults to time.Now; tests can set a fake clock to drive
+	// expiry deterministically together with Tick.
+	Now func() time.Time
+	// Seed, if not 0, is mixed into every hash, ring points and keys alike,
+	// so that rings over the same members place keys differently, e.g. to
+	// compare their balance.
+	Seed uint64
 }
 
 type Consistent struct {
@@ -40,17 +172,51 @@ type Consistent struct {
 
 	config         Config
 	hashFunc       HashFunc
-	sortedSet      []uint64
+	sortedSet      ringIndex
 	partitionCount uint64
+	totalWeight    float64
 	loads          map[string]float64
 	members        map[string]*Member
+	drained        map[string]bool
+	pins           map[string]string
+	ttls           map[string]time.Duration
+	expiry         map[string]time.Time
+	now            func() time.Time
 	partitions     map[int]*Member
+	replicas       map[int][]Member
 	ring           map[uint64]*Member
+	lastRebalance  time.Duration
+	lastMoved      int
+	history        []*Snapshot
+	migrations     map[int]migration
+	epoch          uint64
+}
+
+// migration is the previous owner of a moved partition and when the dual-read
+// window ends.
+type migration struct {
+	from  *Member
+	until time.Time
 }
 
+// New is like NewWithError but panics if config is invalid.
 func New(members []Member, config Config) *Consistent {
+	c, err := NewWithError(members, config)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// NewWithError creates a Consistent for members. Zero config values are
+// replaced by their defaults. It returns ErrNilHashFunc if config.HashFunc is
+// nil and an error wrapping ErrInvalidConfig if the partition count or
+// replication factor is negative, the load is below 1 or ExpectedMembers is
+// negative. If members cannot hold the partitions within their load caps, it
+// returns the *DistributionError that New and later rebalances panic with.
+func NewWithError(members []Member, config Config) (*Consistent, error) {
 	if config.HashFunc == nil {
-		panic("HashFunc cannot be nil")
+		return nil, ErrNilHashFunc
 	}
 	if config.PartitionCount == 0 {
 		config.PartitionCount = DefaultPartitionCount
@@ -61,22 +227,84 @@ func New(members []Member, config Config) *Consistent {
 	if config.Load == 0 {
 		config.Load = DefaultLoad
 	}
+	if config.DisableBoundedLoad {
+		if _, ok := config.Strategy.(Unbounded); config.Strategy != nil && !ok {
+			return nil, fmt.Errorf("%w: DisableBoundedLoad cannot be combined with Strategy", ErrInvalidConfig)
+		}
+		config.Strategy = Unbounded{}
+	}
+	if config.Strategy == nil {
+		config.Strategy = BoundedLoad{}
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	if config.PartitionCount < 0 {
+		return nil, fmt.Errorf("%w: partition count %d must be positive", ErrInvalidConfig, config.PartitionCount)
+	}
+	if config.ReplicationFactor < 0 {
+		return nil, fmt.Errorf("%w: replication factor %d must be positive", ErrInvalidConfig, config.ReplicationFactor)
+	}
+	if !(config.Load >= 1) {
+		return nil, fmt.Errorf("%w: load %v must be at least 1", ErrInvalidConfig, config.Load)
+	}
+	if config.ExpectedMembers < 0 {
+		return nil, fmt.Errorf("%w: expected members %d must not be negative", ErrInvalidConfig, config.ExpectedMembers)
+	}
+	if config.RingImpl != SliceRing && config.RingImpl != TreeRing {
+		return nil, fmt.Errorf("%w: unknown ring implementation %d", ErrInvalidConfig, config.RingImpl)
+	}
 
 	c := &Consistent{
 		config:         config,
-		members:        make(map[string]*Member),
+		members:        make(map[string]*Member, config.ExpectedMembers),
+		drained:        make(map[string]bool),
+		pins:           make(map[string]string),
+		ttls:           make(map[string]time.Duration),
+		expiry:         make(map[string]time.Time),
+		migrations:     make(map[int]migration),
+		now:            config.Now,
 		partitionCount: uint64(config.PartitionCount),
-		ring:           make(map[uint64]*Member),
+		ring:           make(map[uint64]*Member, config.ExpectedMembers*config.ReplicationFactor),
+		sortedSet:      newRingIndex(config.RingImpl, config.ExpectedMembers*config.ReplicationFactor),
 	}
 
 	c.hashFunc = config.HashFunc
+	if config.Seed != 0 {
+		c.hashFunc = seededHash{h: config.HashFunc, seed: config.Seed}
+	}
 	for _, member := range members {
 		c.add(member)
 	}
-	if members != nil {
-		c.distributePartitions()
+	c.sortSet()
+	if len(members) > 0 {
+		if err := c.tryDistributePartitions(); err != nil {
+			return nil, err
+		}
 	}
-	return c
+	return c, nil
+}
+
+// tryDistributePartitions is distributePartitions returning the
+// *DistributionError a strategy panics with instead of panicking.
+func (c *Consistent) tryDistributePartitions() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			de, ok := r.(*DistributionError)
+			if !ok {
+				panic(r)
+			}
+			err = de
+		}
+	}()
+	c.distributePartitions()
+	return nil
+}
+
+// Configuration returns the effective configuration of the ring, with
+// defaults applied for the values left zero in the Config passed to New.
+func (c *Consistent) Configuration() Config {
+	return c.config
 }
 
 func (c *Consistent) GetMembers() []Member {
@@ -98,6 +326,26 @@ func (c *Consistent) AverageLoad() float64 {
 	return c.averageLoad()
 }
 
+// LoadCap returns the maximum number of partitions a member may own, i.e. the
+// bounded-load cap used when distributing partitions. It has the same value
+// as AverageLoad. With weighted members it is the cap of a member of the
+// mean weight; use LoadCaps for the per-member values.
+func (c *Consistent) LoadCap() float64 {
+	return c.AverageLoad()
+}
+
+// LoadCaps returns the bounded-load cap of every member, keyed by name.
+func (c *Consistent) LoadCaps() map[string]float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	res := make(map[string]float64, len(c.members))
+	for name := range c.members {
+		res[name] = c.memberCap(name)
+	}
+	return res
+}
+
 func (c *Consistent) averageLoad() float64 {
 	if len(c.members) == 0 {
 		return 0
@@ -107,63 +355,127 @@ func (c *Consistent) averageLoad() float64 {
 	return math.Ceil(avgLoad)
 }
 
-func (c *Consistent) distributeWithLoad(partID, idx int, partitions map[int]*Member, loads map[string]float64) {
-	avgLoad := c.averageLoad()
-	var count int
-	for {
-		count++
-		if count >= len(c.sortedSet) {
-			// User needs to decrease partition count, increase member count or increase load factor.
-			panic("not enough room to distribute partitions")
-		}
-		i := c.sortedSet[idx]
-		member := *c.ring[i]
-		load := loads[member.String()]
-		if load+1 <= avgLoad {
-			partitions[partID] = &member
-			loads[member.String()]++
-			return
-		}
-		idx++
-		if idx >= len(c.sortedSet) {
-			idx = 0
-		}
+// memberCap is the bounded-load cap of a member, scaled by its weight relative
+// to the mean weight. Without weighted members it equals averageLoad.
+func (c *Consistent) memberCap(name string) float64 {
+	member, ok := c.members[name]
+	if !ok {
+		return 0
 	}
+	avgLoad := float64(c.partitionCount/uint64(len(c.members))) * c.config.Load
+	scale := weightOf(*member) * float64(len(c.members)) / c.totalWeight
+	return math.Ceil(avgLoad * scale)
 }
 
 func (c *Consistent) distributePartitions() {
+	start := time.Now()
 	loads := make(map[string]float64)
 	partitions := make(map[int]*Member)
+	ring := &RingView{c: c, loads: loads}
 
 	bs := make([]byte, 8)
 	for partID := uint64(0); partID < c.partitionCount; partID++ {
+		if owner, ok := c.partitions[int(partID)]; ok && c.drained[(*owner).String()] {
+			// Draining members keep what they already own until they are removed.
+			partitions[int(partID)] = owner
+			loads[(*owner).String()]++
+			continue
+		}
 		binary.LittleEndian.PutUint64(bs, partID)
 		key := c.hashFunc.Sum64(bs)
-		idx := sort.Search(len(c.sortedSet), func(i int) bool {
-			return c.sortedSet[i] >= key
-		})
-		if idx >= len(c.sortedSet) {
-			idx = 0
+		member := c.config.Strategy.Assign(int(partID), ring.Search(key), ring)
+		partitions[int(partID)] = &member
+		loads[member.String()]++
+	}
+
+	var moved int
+	for partID, member := range partitions {
+		if old, ok := c.partitions[partID]; !ok || (*old).String() != (*member).String() {
+			moved++
+			if ok && c.config.MigrationWindow > 0 {
+				c.migrations[partID] = migration{from: old, until: c.now().Add(c.config.MigrationWindow)}
+			}
 		}
-		c.distributeWithLoad(int(partID), idx, partitions, loads)
 	}
 	c.partitions = partitions
 	c.loads = loads
+	c.precomputeReplicas()
+	c.lastRebalance = time.Since(start)
+	c.lastMoved = moved
+	c.epoch++
+	c.recordHistory()
+}
+
+// GetPartitionOwnersDuringMigration returns the current owner of partID and,
+// if the partition moved within the last Config.MigrationWindow, its previous
+// owner, so that clients can read from both while data migrates. oldOwner is
+// nil outside a migration window, if the partition moved back, or if the
+// previous owner has since left the ring.
+func (c *Consistent) GetPartitionOwnersDuringMigration(partID int) (newOwner, oldOwner Member) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	newOwner = c.getPartitionOwner(partID)
+	m, ok := c.migrations[partID]
+	if !ok || newOwner == nil || !c.now().Before(m.until) {
+		return newOwner, nil
+	}
+	from := (*m.from).String()
+	if _, ok := c.members[from]; !ok || from == newOwner.String() {
+		return newOwner, nil
+	}
+	return newOwner, *m.from
+}
+
+// LastRebalance returns how long the last partition table rebuild took,
+// including replica precomputation, and how many partitions changed owner in
+// it. Partitions that had no owner before, as on the first rebuild, count as
+// moved. It returns zeros if the table was never built.
+func (c *Consistent) LastRebalance() (time.Duration, int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.lastRebalance, c.lastMoved
+}
+
+// precomputeReplicas refreshes the replica sets served by
+// GetPartitionReplicas.
+func (c *Consistent) precomputeReplicas() {
+	if c.config.PrecomputeReplicas <= 0 {
+		return
+	}
+	count := c.config.PrecomputeReplicas
+	if count > len(c.members) {
+		count = len(c.members)
+	}
+	replicas := make(map[int][]Member, c.partitionCount)
+	for partID := 0; partID < int(c.partitionCount); partID++ {
+		closest, err := c.closestN(partID, count)
+		if err != nil {
+			// Too few distinct members; fall back to the owner alone.
+			closest = []Member{c.getPartitionOwner(partID)}
+		}
+		replicas[partID] = closest
+	}
+	c.replicas = replicas
 }
 
 func (c *Consistent) add(member Member) {
-	for i := 0; i < c.config.ReplicationFactor; i++ {
+	for i := 0; i < c.pointCount(member); i++ {
 		key := []byte(fmt.Sprintf("%s%d", member.String(), i))
 		h := c.hashFunc.Sum64(key)
 		c.ring[h] = &member
-		c.sortedSet = append(c.sortedSet, h)
+		c.sortedSet.Append(h)
 	}
-	// sort hashes ascendingly
-	sort.Slice(c.sortedSet, func(i int, j int) bool {
-		return c.sortedSet[i] < c.sortedSet[j]
-	})
 	// Storing member at this map is useful to find backup members of a partition.
 	c.members[member.String()] = &member
+	c.totalWeight += weightOf(member)
+}
+
+// sortSet sorts ring hashes ascendingly. It is called once after a batch of
+// add calls rather than after every member.
+func (c *Consistent) sortSet() {
+	c.sortedSet.Sort()
 }
 
 // Add adds a new member to the consistent hash circle.
@@ -176,16 +488,21 @@ func (c *Consistent) Add(member Member) {
 		return
 	}
 	c.add(member)
+	c.sortSet()
 	c.distributePartitions()
 }
 
-func (c *Consistent) delSlice(val uint64) {
-	for i := 0; i < len(c.sortedSet); i++ {
-		if c.sortedSet[i] == val {
-			c.sortedSet = append(c.sortedSet[:i], c.sortedSet[i+1:]...)
-			break
-		}
+// Drain marks a member as draining: it keeps the partitions it currently owns,
+// but is never assigned new ones by later redistributions. A subsequent Remove
+// completes the eviction. Draining an unknown member is a no-op.
+func (c *Consistent) Drain(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.members[name]; !ok {
+		return
 	}
+	c.drained[name] = true
 }
 
 func (c *Consistent) Remove(name string) {
@@ -196,17 +513,137 @@ func (c *Consistent) Remove(name string) {
 		// There is no member with that name. Quit immediately.
 		return
 	}
+	c.remove(name)
+	c.redistribute()
+}
 
-	for i := 0; i < c.config.ReplicationFactor; i++ {
-		key := []byte(fmt.Sprintf("%s%d", name, i))
-		h := c.hashFunc.Sum64(key)
-		delete(c.ring, h)
-		c.delSlice(h)
+// RemoveWhere removes every member whose name satisfies pred and redistributes
+// partitions once. It returns the number of members removed.
+func (c *Consistent) RemoveWhere(pred func(name string) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var names []string
+	for name := range c.members {
+		if pred(name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		c.remove(names...)
+		c.redistribute()
+	}
+	return len(names)
+}
+
+// SetMembers makes members the exact member set: members not on the ring are
+// added, members not in the list are removed, and partitions are
+// redistributed once. Members are identified by String(); for repeated names
+// the first is used. It returns the number of members added and removed.
+func (c *Consistent) SetMembers(members []Member) (added, removed int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	toAdd, toRemove := c.membershipDiff(members)
+	c.applyMembership(toAdd, toRemove)
+	return len(toAdd), len(toRemove)
+}
+
+// SetMembersCtx is like SetMembers but first checks ctx, once the lock is
+// held. If ctx is done, it returns ctx.Err() and leaves the ring unchanged;
+// otherwise the new member set is applied in full.
+func (c *Consistent) SetMembersCtx(ctx context.Context, members []Member) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	toAdd, toRemove := c.membershipDiff(members)
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-	delete(c.members, name)
+	c.applyMembership(toAdd, toRemove)
+	return nil
+}
+
+// membershipDiff returns the members SetMembers adds and the names it
+// removes, without changing the ring.
+func (c *Consistent) membershipDiff(members []Member) (toAdd []Member, toRemove []string) {
+	wanted := make(map[string]bool, len(members))
+	for _, member := range members {
+		name := member.String()
+		if _, ok := c.members[name]; !ok && !wanted[name] {
+			toAdd = append(toAdd, member)
+		}
+		wanted[name] = true
+	}
+	for name := range c.members {
+		if !wanted[name] {
+			toRemove = append(toRemove, name)
+		}
+	}
+	return toAdd, toRemove
+}
+
+func (c *Consistent) applyMembership(toAdd []Member, toRemove []string) {
+	if len(toRemove) > 0 {
+		c.remove(toRemove...)
+	}
+	for _, member := range toAdd {
+		c.add(member)
+	}
+	if len(toAdd) > 0 {
+		c.sortSet()
+	}
+	if len(toAdd) > 0 || len(toRemove) > 0 {
+		c.redistribute()
+	}
+}
+
+// remove deletes the named members and their ring points without
+// redistributing partitions. Bulk removals pass every name in one call, so
+// the ring index, pins and total weight are updated once rather than once
+// per member.
+func (c *Consistent) remove(names ...string) {
+	var points []uint64
+	for _, name := range names {
+		member := c.members[name]
+		count := c.pointCount(*member)
+		for i := 0; i < count; i++ {
+			key := []byte(fmt.Sprintf("%s%d", name, i))
+			h := c.hashFunc.Sum64(key)
+			delete(c.ring, h)
+			points = append(points, h)
+		}
+		delete(c.members, name)
+		delete(c.drained, name)
+		delete(c.ttls, name)
+		delete(c.expiry, name)
+	}
+	c.sortedSet.Delete(points)
+	for key, pinned := range c.pins {
+		if _, ok := c.members[pinned]; !ok {
+			delete(c.pins, key)
+		}
+	}
+	// Summing afresh keeps fractional weights from accumulating rounding
+	// errors over many removals.
+	c.totalWeight = 0
+	for _, m := range c.members {
+		c.totalWeight += weightOf(*m)
+	}
+}
+
+// redistribute rebuilds the partition table after members were removed.
+func (c *Consistent) redistribute() {
 	if len(c.members) == 0 {
-		// consistent hash ring is empty now. Reset the partition table.
+		// consistent hash ring is empty now. Reset the partition table and
+		// the loads of the removed members along with the ring itself.
 		c.partitions = make(map[int]*Member)
+		c.replicas = nil
+		c.loads = make(map[string]float64)
+		c.ring = make(map[uint64]*Member)
+		c.sortedSet = newRingIndex(c.config.RingImpl, 0)
+		c.epoch++
+		c.recordHistory()
 		return
 	}
 	c.distributePartitions()
@@ -224,8 +661,185 @@ func (c *Consistent) LoadDistribution() map[string]float64 {
 	return res
 }
 
+// RingPoint is a virtual node on the hash circle.
+type RingPoint struct {
+	Hash  uint64
+	Owner string
+}
+
+// RingLookup returns the hash of key, the first ring point clockwise from it
+// and that point's member. This is raw ring placement, for debugging: keys
+// are not routed this way. LocateKey maps a key to a partition with
+// FindPartitionID and returns the partition's owner, and the ring is only used
+// to assign partitions, starting from the hash of the partition ID and subject
+// to the distribution strategy. The two owners can therefore differ. On an
+// empty ring ownerVNodeHash is 0 and owner is nil.
+func (c *Consistent) RingLookup(key []byte) (keyHash, ownerVNodeHash uint64, owner Member) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	keyHash = c.hashFunc.Sum64(key)
+	if c.sortedSet.Len() == 0 {
+		return keyHash, 0, nil
+	}
+	idx := c.sortedSet.Search(keyHash)
+	if idx >= c.sortedSet.Len() {
+		idx = 0
+	}
+	ownerVNodeHash = c.sortedSet.At(idx)
+	return keyHash, ownerVNodeHash, *c.ring[ownerVNodeHash]
+}
+
+// RingPoints returns a copy of the ring points in ascending hash order.
+func (c *Consistent) RingPoints() []RingPoint {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	points := make([]RingPoint, c.sortedSet.Len())
+	for i := range points {
+		h := c.sortedSet.At(i)
+		points[i] = RingPoint{Hash: h, Owner: (*c.ring[h]).String()}
+	}
+	return points
+}
+
+// Validate checks the internal invariants of the ring and returns an error
+// wrapping ErrCorruptRing describing the first violation found.
+func (c *Consistent) Validate() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.sortedSet.Len() != len(c.ring) {
+		return fmt.Errorf("%w: %d sorted hashes but %d ring points", ErrCorruptRing, c.sortedSet.Len(), len(c.ring))
+	}
+	for i := 0; i < c.sortedSet.Len(); i++ {
+		h := c.sortedSet.At(i)
+		if i > 0 && c.sortedSet.At(i-1) >= h {
+			return fmt.Errorf("%w: sorted set is not strictly ascending at index %d", ErrCorruptRing, i)
+		}
+		member, ok := c.ring[h]
+		if !ok {
+			return fmt.Errorf("%w: hash %d has no ring point", ErrCorruptRing, h)
+		}
+		if _, ok := c.members[(*member).String()]; !ok {
+			return fmt.Errorf("%w: ring point %d owned by unknown member %s", ErrCorruptRing, h, *member)
+		}
+	}
+
+	if len(c.members) == 0 {
+		return nil
+	}
+	if len(c.partitions) != int(c.partitionCount) {
+		return fmt.Errorf("%w: %d partitions assigned, want %d", ErrCorruptRing, len(c.partitions), c.partitionCount)
+	}
+	for partID, member := range c.partitions {
+		if _, ok := c.members[(*member).String()]; !ok {
+			return fmt.Errorf("%w: partition %d owned by unknown member %s", ErrCorruptRing, partID, *member)
+		}
+	}
+	var total float64
+	for _, load := range c.loads {
+		total += load
+	}
+	if total != float64(c.partitionCount) {
+		return fmt.Errorf("%w: loads sum to %v, want %d", ErrCorruptRing, total, c.partitionCount)
+	}
+	return nil
+}
+
+// ImportPartitionTable replaces the partition table with table, which maps
+// every partition ID to an owner name, e.g. as exported by another consistent
+// hashing library. resolve maps each name to a Member that must already be on
+// the ring. The table is taken as is, so it may exceed the load caps until the
+// next Add or Remove rebalances it. On error the ring is left unchanged.
+func (c *Consistent) ImportPartitionTable(table map[int]string, resolve func(string) Member) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(table) != int(c.partitionCount) {
+		return fmt.Errorf("%w: %d partitions given, want %d", ErrInvalidPartitionTable, len(table), c.partitionCount)
+	}
+	partitions := make(map[int]*Member, len(table))
+	loads := make(map[string]float64)
+	for partID, name := range table {
+		if partID < 0 || partID >= int(c.partitionCount) {
+			return fmt.Errorf("%w: partition %d out of range", ErrInvalidPartitionTable, partID)
+		}
+		var member *Member
+		if m := resolve(name); m != nil {
+			member = c.members[m.String()]
+		}
+		if member == nil {
+			return fmt.Errorf("%w: partition %d owner %s", ErrMemberNotFound, partID, name)
+		}
+		partitions[partID] = member
+		loads[(*member).String()]++
+	}
+	c.partitions = partitions
+	c.loads = loads
+	c.precomputeReplicas()
+	c.epoch++
+	c.recordHistory()
+	return nil
+}
+
+// RoutingTable is a copy of the partition table for clients that route keys
+// without holding the ring. A client computes a key's partition ID from the
+// key hash and PartitionCount, using the same HashFunc, Config.Seed and
+// Config.PartitionMapping as the ring (see HashKey and
+// FindPartitionIDForHash), and looks up its owner in Owners.
+type RoutingTable struct {
+	// Owners maps every partition ID to its owner's name. It is empty if the
+	// ring is empty.
+	Owners         map[int]string `json:"owners"`
+	PartitionCount int            `json:"partition_count"`
+	// Epoch is the ring's Epoch when the table was exported, so a client can
+	// tell whether its copy is stale.
+	Epoch uint64 `json:"epoch"`
+}
+
+// Epoch returns a counter that grows by one every time the partition table
+// is rebuilt or replaced: by Add, Remove, SetMembers and the other membership
+// changes, and by ImportPartitionTable. Calls that change nothing, such as
+// adding a member that is already present, leave it as is. It starts at 0 for
+// an empty ring and 1 for a ring created with members.
+func (c *Consistent) Epoch() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.epoch
+}
+
+// ExportRoutingTable returns the current partition table as a RoutingTable.
+func (c *Consistent) ExportRoutingTable() RoutingTable {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	owners := make(map[int]string, len(c.partitions))
+	for partID, member := range c.partitions {
+		owners[partID] = (*member).String()
+	}
+	return RoutingTable{Owners: owners, PartitionCount: int(c.partitionCount), Epoch: c.epoch}
+}
+
 func (c *Consistent) FindPartitionID(key []byte) int {
-	hKey := c.hashFunc.Sum64(key)
+	return c.FindPartitionIDForHash(c.HashKey(key))
+}
+
+// HashKey returns the hash the ring places key by: Config.HashFunc's hash,
+// with Config.Seed mixed in if it is set.
+func (c *Consistent) HashKey(key []byte) uint64 {
+	return c.hashFunc.Sum64(key)
+}
+
+// FindPartitionIDForHash is like FindPartitionID for a key that was already
+// hashed with HashKey. Without Config.Seed that is the same as hashing with
+// Config.HashFunc.
+func (c *Consistent) FindPartitionIDForHash(hKey uint64) int {
+	if c.config.PartitionMapping == MultiplyShift {
+		hi, _ := bits.Mul64(hKey, c.partitionCount)
+		return int(hi)
+	}
 	return int(hKey % c.partitionCount)
 }
 
@@ -236,6 +850,26 @@ func (c *Consistent) GetPartitionOwner(partID int) Member {
 	return c.getPartitionOwner(partID)
 }
 
+// GetPartitionOwnerForHash returns the owner of the partition of a key that
+// was already hashed with HashKey, skipping the hash done by LocateKey. Pins are not consulted, since they are keyed
+// by the key itself.
+func (c *Consistent) GetPartitionOwnerForHash(hKey uint64) Member {
+	return c.GetPartitionOwner(c.FindPartitionIDForHash(hKey))
+}
+
+// GetPartitionOwners returns the owners of partIDs in input order, under a
+// single lock. Unknown partition IDs yield nil.
+func (c *Consistent) GetPartitionOwners(partIDs []int) []Member {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	owners := make([]Member, len(partIDs))
+	for i, partID := range partIDs {
+		owners[i] = c.getPartitionOwner(partID)
+	}
+	return owners
+}
+
 func (c *Consistent) getPartitionOwner(partID int) Member {
 	member, ok := c.partitions[partID]
 	if !ok {
@@ -245,65 +879,280 @@ func (c *Consistent) getPartitionOwner(partID int) Member {
 	return *member
 }
 
+// LocateKey returns the member responsible for key: the member it is pinned
+// to, if any, otherwise the owner of its partition.
 func (c *Consistent) LocateKey(key []byte) Member {
-	partID := c.FindPartitionID(key)
-	return c.GetPartitionOwner(partID)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.locateKey(key)
+}
+
+func (c *Consistent) locateKey(key []byte) Member {
+	if name, ok := c.pins[string(key)]; ok {
+		return *c.members[name]
+	}
+	return c.getPartitionOwner(c.FindPartitionID(key))
+}
+
+// GroupKeysByOwner routes every key as LocateKey does, under a single lock,
+// and groups the keys by the String() of their owner, preserving input order
+// within each group. It returns an empty map when there are no members.
+func (c *Consistent) GroupKeysByOwner(keys [][]byte) map[string][][]byte {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	groups := make(map[string][][]byte)
+	if len(c.members) == 0 {
+		return groups
+	}
+	for _, key := range keys {
+		owner := c.locateKey(key).String()
+		groups[owner] = append(groups[owner], key)
+	}
+	return groups
+}
+
+// Pin routes key to the named member regardless of hashing. Pins survive
+// rebalances but are dropped when the member is removed. FindPartitionID is
+// not affected: a pin overrides the owner, not the partition. GetClosestN,
+// GetClosestNBatch and GetPrimaryAndBackup put the pinned member first. It
+// returns ErrMemberNotFound if there is no such member.
+func (c *Consistent) Pin(key []byte, memberName string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.members[memberName]; !ok {
+		return ErrMemberNotFound
+	}
+	c.pins[string(key)] = memberName
+	return nil
+}
+
+// Unpin removes the pin for key, if any.
+func (c *Consistent) Unpin(key []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.pins, string(key))
+}
+
+// pinFirst returns members with the member key is pinned to, if any, moved or
+// added to the front. The length is kept, so an added pinned member pushes
+// out the last one.
+func (c *Consistent) pinFirst(key []byte, members []Member) []Member {
+	name, ok := c.pins[string(key)]
+	if !ok || len(members) == 0 {
+		return members
+	}
+	res := make([]Member, 1, len(members))
+	res[0] = *c.members[name]
+	for _, member := range members {
+		if len(res) == len(members) {
+			break
+		}
+		if member.String() != name {
+			res = append(res, member)
+		}
+	}
+	return res
 }
 
 func (c *Consistent) getClosestN(partID, count int) ([]Member, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	var res []Member
+	return c.closestN(partID, count)
+}
+
+func (c *Consistent) closestN(partID, count int) ([]Member, error) {
 	if count > len(c.members) {
-		return res, ErrInsufficientMemberCount
+		return nil, ErrInsufficientMemberCount
+	}
+	if !c.validPartition(partID) {
+		return nil, ErrInvalidPartition
 	}
-
-	var ownerKey uint64
 	owner := c.getPartitionOwner(partID)
-	// Hash and sort all the names.
-	var keys []uint64
-	kMems := make(map[uint64]*Member)
-	for name, member := range c.members {
-		key := c.hashFunc.Sum64([]byte(name))
-		if name == owner.String() {
-			ownerKey = key
-		}
-		keys = append(keys, key)
-		kMems[key] = member
-	}
-	sort.Slice(keys, func(i, j int) bool {
-		return keys[i] < keys[j]
-	})
-
-	// Find the key owner
-	idx := 0
-	for idx < len(keys) {
-		if keys[idx] == ownerKey {
-			key := keys[idx]
-			res = append(res, *kMems[key])
-			break
+	res := []Member{owner}
+
+	// Find the closest(replica owners) members: walk the ring clockwise from
+	// the partition's position and take members in the order their points
+	// appear, skipping the owner. A member's chance to be the next replica is
+	// therefore proportional to its number of ring points.
+	bs := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bs, uint64(partID))
+	partKey := c.hashFunc.Sum64(bs)
+	n := c.sortedSet.Len()
+	idx := c.sortedSet.Search(partKey)
+	seen := map[string]bool{owner.String(): true}
+	for steps := 0; len(res) < count && steps < n; steps++ {
+		if idx >= n {
+			idx = 0
 		}
+		member := *c.ring[c.sortedSet.At(idx)]
 		idx++
+		if seen[member.String()] {
+			continue
+		}
+		seen[member.String()] = true
+		res = append(res, member)
 	}
+	if len(res) < count {
+		// Ring point collisions left fewer distinct members than asked for.
+		return nil, ErrInsufficientMemberCount
+	}
+	return res, nil
+}
 
-	// Find the closest(replica owners) members.
-	for len(res) < count {
-		idx++
-		if idx >= len(keys) {
-			idx = 0
+// GetClosestNBatch is like calling GetClosestN for every key, pins included,
+// but takes the lock once for the whole batch, so every key sees the same
+// ring. The result holds one slice per key, in input order.
+func (c *Consistent) GetClosestNBatch(keys [][]byte, count int) ([][]Member, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	res := make([][]Member, len(keys))
+	for i, key := range keys {
+		closest, err := c.closestN(c.FindPartitionID(key), count)
+		if err != nil {
+			return nil, err
 		}
-		key := keys[idx]
-		res = append(res, *kMems[key])
+		res[i] = c.pinFirst(key, closest)
 	}
 	return res, nil
 }
 
+// GetClosestN returns count distinct members for key's partition, starting
+// with LocateKey(key): the member key is pinned to, if any, otherwise the
+// partition's owner. It returns ErrInsufficientMemberCount if there are not
+// enough distinct members.
 func (c *Consistent) GetClosestN(key []byte, count int) ([]Member, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	closest, err := c.closestN(c.FindPartitionID(key), count)
+	if err != nil {
+		return nil, err
+	}
+	return c.pinFirst(key, closest), nil
+}
+
+// GetReplicas is GetClosestN with Config.DefaultReplicaCount. It returns an
+// error wrapping ErrInvalidConfig if DefaultReplicaCount is below 1.
+func (c *Consistent) GetReplicas(key []byte) ([]Member, error) {
+	count := c.config.DefaultReplicaCount
+	if count < 1 {
+		return nil, fmt.Errorf("%w: default replica count %d must be at least 1", ErrInvalidConfig, count)
+	}
+	return c.GetClosestN(key, count)
+}
+
+// GetPartitionReplicas returns the replica set of partID computed at the last
+// rebalance: up to Config.PrecomputeReplicas members in GetClosestNForPartition
+// order. It returns nil if PrecomputeReplicas is not set, the ring is empty
+// or partID is unknown.
+func (c *Consistent) GetPartitionReplicas(partID int) []Member {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	replicas, ok := c.replicas[partID]
+	if !ok {
+		return nil
+	}
+	// Copy so callers cannot modify the shared replica set.
+	return append([]Member(nil), replicas...)
+}
+
+// GetPrimaryAndBackup returns LocateKey(key), i.e. the member key is pinned
+// to or else the owner of key's partition, and a backup member: the first
+// member other than the primary found walking the ring clockwise from the
+// partition's position. It avoids the member sort done by GetClosestN and
+// returns ErrInsufficientMemberCount when there are fewer than two members.
+func (c *Consistent) GetPrimaryAndBackup(key []byte) (Member, Member, error) {
 	partID := c.FindPartitionID(key)
-	return c.getClosestN(partID, count)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.members) < 2 {
+		return nil, nil, ErrInsufficientMemberCount
+	}
+	primary := c.locateKey(key)
+
+	bs := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bs, uint64(partID))
+	partKey := c.hashFunc.Sum64(bs)
+	idx := c.sortedSet.Search(partKey)
+	for i := 0; i < c.sortedSet.Len(); i++ {
+		if idx >= c.sortedSet.Len() {
+			idx = 0
+		}
+		member := *c.ring[c.sortedSet.At(idx)]
+		if member.String() != primary.String() {
+			return primary, member, nil
+		}
+		idx++
+	}
+	return nil, nil, ErrInsufficientMemberCount
+}
+
+// GetPartitionOwnerFallback returns the owner of partID unless isDown reports
+// it as down, in which case it returns the first member in the partition's
+// GetClosestNForPartition order that is not down. It returns
+// ErrNoHealthyMember if every member is down and ErrInsufficientMemberCount
+// if the ring is empty, and ErrInvalidPartition if partID is out of range.
+func (c *Consistent) GetPartitionOwnerFallback(partID int, isDown func(Member) bool) (Member, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.ownerFallback(partID, isDown)
+}
+
+// LocateKeyHealthy returns LocateKey(key) if healthy reports it as healthy,
+// and otherwise the first healthy member in the order of
+// GetClosestNForPartition for key's partition. It returns ErrNoHealthyMember
+// if no member is healthy and ErrInsufficientMemberCount if the ring is
+// empty.
+func (c *Consistent) LocateKeyHealthy(key []byte, healthy func(Member) bool) (Member, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if name, ok := c.pins[string(key)]; ok && healthy(*c.members[name]) {
+		return *c.members[name], nil
+	}
+	return c.ownerFallback(c.FindPartitionID(key), func(m Member) bool { return !healthy(m) })
+}
+
+func (c *Consistent) ownerFallback(partID int, isDown func(Member) bool) (Member, error) {
+	if len(c.members) == 0 {
+		return nil, ErrInsufficientMemberCount
+	}
+	if !c.validPartition(partID) {
+		return nil, ErrInvalidPartition
+	}
+	owner := c.getPartitionOwner(partID)
+	if !isDown(owner) {
+		return owner, nil
+	}
+	closest, err := c.closestN(partID, len(c.members))
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range closest[1:] {
+		if !isDown(member) {
+			return member, nil
+		}
+	}
+	return nil, ErrNoHealthyMember
+}
+
+// validPartition reports whether partID is in [0, PartitionCount).
+func (c *Consistent) validPartition(partID int) bool {
+	return partID >= 0 && uint64(partID) < c.partitionCount
 }
 
+// GetClosestNForPartition is GetClosestN for a partition ID. It returns
+// ErrInvalidPartition if partID is out of range.
 func (c *Consistent) GetClosestNForPartition(partID, count int) ([]Member, error) {
 	return c.getClosestN(partID, count)
 }
@@ -1,8 +1,19 @@
 package consistent
 
 import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"hash/fnv"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 func newConfig() Config {
@@ -20,6 +31,32 @@ func (tm testMember) String() string {
 	return string(tm)
 }
 
+type weightedMember struct {
+	name   string
+	weight int
+}
+
+func (wm weightedMember) String() string {
+	return wm.name
+}
+
+func (wm weightedMember) Weight() int {
+	return wm.weight
+}
+
+type fractionalMember struct {
+	name   string
+	weight float64
+}
+
+func (fm fractionalMember) String() string {
+	return fm.name
+}
+
+func (fm fractionalMember) Weight() float64 {
+	return fm.weight
+}
+
 type hashFunc struct{}
 
 func (hs hashFunc) Sum64(data []byte) uint64 {
@@ -28,6 +65,20 @@ func (hs hashFunc) Sum64(data []byte) uint64 {
 	return h.Sum64()
 }
 
+// mixedHashFunc finalizes FNV with the SplitMix64 mixer so that the high bits
+// are as well distributed as the low ones.
+type mixedHashFunc struct{}
+
+func (hs mixedHashFunc) Sum64(data []byte) uint64 {
+	x := hashFunc{}.Sum64(data)
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
 func TestConsistentAdd(t *testing.T) {
 }
 
@@ -45,3 +96,1842 @@ func TestConsistentInsufficientMemberCount(t *testing.T) {
 
 func TestConsistentClosestMembers(t *testing.T) {
 }
+
+func TestConsistentMultiplyShiftDistribution(t *testing.T) {
+	cfg := newConfig()
+	cfg.HashFunc = mixedHashFunc{}
+	cfg.PartitionMapping = MultiplyShift
+	c := New(nil, cfg)
+
+	const keyCount = 23000
+	counts := make([]int, cfg.PartitionCount)
+	for i := 0; i < keyCount; i++ {
+		partID := c.FindPartitionID([]byte(fmt.Sprintf("key-%d", i)))
+		if partID < 0 || partID >= cfg.PartitionCount {
+			t.Fatalf("partition ID %d out of range", partID)
+		}
+		counts[partID]++
+	}
+
+	expected := keyCount / cfg.PartitionCount
+	for partID, count := range counts {
+		if math.Abs(float64(count-expected)) > 0.1*float64(expected) {
+			t.Errorf("partition %d got %d keys, expected about %d", partID, count, expected)
+		}
+	}
+}
+
+func TestConsistentLoadCap(t *testing.T) {
+	members := []Member{testMember("node1"), testMember("node2"), testMember("node3")}
+	c := New(members, newConfig())
+
+	// 23 partitions / 3 members = 7, 7 * 1.25 = 8.75, rounded up.
+	if got := c.LoadCap(); got != 9 {
+		t.Fatalf("LoadCap() = %v, want 9", got)
+	}
+	for member, load := range c.LoadDistribution() {
+		if load > c.LoadCap() {
+			t.Errorf("member %s has load %v above cap %v", member, load, c.LoadCap())
+		}
+	}
+}
+
+func TestConsistentStatsJSON(t *testing.T) {
+	members := []Member{testMember("node1"), testMember("node2"), testMember("node3")}
+	c := New(members, newConfig())
+
+	data, err := json.Marshal(c.Stats())
+	if err != nil {
+		t.Fatalf("json.Marshal(Stats()) returned error: %v", err)
+	}
+	var stats Stats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		t.Fatalf("json.Unmarshal returned error: %v", err)
+	}
+	if len(stats.Members) != 3 || stats.Members[0] != "node1" {
+		t.Errorf("unexpected members: %v", stats.Members)
+	}
+	if stats.PartitionCount != 23 || stats.AverageLoad != c.AverageLoad() {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	var total float64
+	for _, load := range stats.Loads {
+		total += load
+	}
+	if total != 23 {
+		t.Errorf("loads sum to %v, want 23", total)
+	}
+
+	data, err = c.LoadDistributionJSON()
+	if err != nil {
+		t.Fatalf("LoadDistributionJSON returned error: %v", err)
+	}
+	var loads map[string]float64
+	if err := json.Unmarshal(data, &loads); err != nil {
+		t.Fatalf("json.Unmarshal returned error: %v", err)
+	}
+	for member, load := range c.LoadDistribution() {
+		if loads[member] != load {
+			t.Errorf("member %s: got load %v, want %v", member, loads[member], load)
+		}
+	}
+}
+
+func TestConsistentDrain(t *testing.T) {
+	members := []Member{testMember("node1"), testMember("node2"), testMember("node3")}
+	c := New(members, newConfig())
+
+	c.Drain("node1")
+	last := c.LoadDistribution()["node1"]
+
+	steps := []func(){
+		func() { c.Add(testMember("node4")) },
+		func() { c.Add(testMember("node5")) },
+		func() { c.Remove("node2") },
+		func() { c.Add(testMember("node6")) },
+	}
+	for i, step := range steps {
+		step()
+		load := c.LoadDistribution()["node1"]
+		if load > last {
+			t.Fatalf("step %d: drained member load increased from %v to %v", i, last, load)
+		}
+		last = load
+	}
+
+	c.Remove("node1")
+	for partID := 0; partID < 23; partID++ {
+		if owner := c.GetPartitionOwner(partID); owner == nil || owner.String() == "node1" {
+			t.Fatalf("partition %d owned by %v after removing drained member", partID, owner)
+		}
+	}
+}
+
+func TestConsistentDrainUnbounded(t *testing.T) {
+	cfg := newConfig()
+	cfg.PartitionCount = 71
+	cfg.HashFunc = mixedHashFunc{}
+	cfg.DisableBoundedLoad = true
+	c := New([]Member{testMember("a"), testMember("b"), testMember("c")}, cfg)
+
+	c.Drain("a")
+	before := c.LoadDistribution()
+	if before["a"] == 0 || before["b"] == 0 {
+		t.Fatalf("test needs a and b to own partitions before Drain: %v", before)
+	}
+	// b's partitions would partly fall to a if Unbounded ignored draining.
+	c.Remove("b")
+	if after := c.LoadDistribution(); after["a"] > before["a"] {
+		t.Errorf("drained member load increased from %v to %v", before["a"], after["a"])
+	}
+}
+
+func benchmarkNew(b *testing.B, expectedMembers int) {
+	members := make([]Member, 10000)
+	for i := range members {
+		members[i] = testMember(fmt.Sprintf("node%d", i))
+	}
+	cfg := newConfig()
+	cfg.PartitionCount = 20011
+	cfg.HashFunc = mixedHashFunc{}
+	cfg.ExpectedMembers = expectedMembers
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		New(members, cfg)
+	}
+}
+
+func BenchmarkNew10kMembers(b *testing.B) {
+	benchmarkNew(b, 0)
+}
+
+func BenchmarkNew10kMembersExpected(b *testing.B) {
+	benchmarkNew(b, 10000)
+}
+
+func TestConsistentValidate(t *testing.T) {
+	members := []Member{testMember("node1"), testMember("node2"), testMember("node3")}
+	c := New(members, newConfig())
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate() on a fresh ring returned %v", err)
+	}
+
+	c.Add(testMember("node4"))
+	c.Remove("node2")
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate() after Add/Remove returned %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(c *Consistent)
+	}{
+		{
+			name: "unsorted set",
+			corrupt: func(c *Consistent) {
+				set := *c.sortedSet.(*sliceRing)
+				set[0], set[1] = set[1], set[0]
+			},
+		},
+		{
+			name:    "missing ring point",
+			corrupt: func(c *Consistent) { delete(c.ring, c.sortedSet.At(0)) },
+		},
+		{
+			name: "unknown partition owner",
+			corrupt: func(c *Consistent) {
+				var m Member = testMember("ghost")
+				c.partitions[0] = &m
+			},
+		},
+		{
+			name:    "load mismatch",
+			corrupt: func(c *Consistent) { c.loads["node1"]++ },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(members, newConfig())
+			tt.corrupt(c)
+			if err := c.Validate(); !errors.Is(err, ErrCorruptRing) {
+				t.Errorf("Validate() = %v, want ErrCorruptRing", err)
+			}
+		})
+	}
+}
+
+func TestConsistentWeightedClosestN(t *testing.T) {
+	members := []Member{
+		weightedMember{"node1", 1},
+		weightedMember{"node2", 1},
+		weightedMember{"node3", 1},
+		weightedMember{"node4", 4},
+	}
+	cfg := newConfig()
+	cfg.PartitionCount = 271
+	cfg.HashFunc = mixedHashFunc{}
+	c := New(members, cfg)
+
+	loads := c.LoadDistribution()
+	caps := c.LoadCaps()
+	for _, name := range []string{"node1", "node2", "node3"} {
+		if loads["node4"] <= loads[name] {
+			t.Errorf("heavy member load %v not above %s load %v", loads["node4"], name, loads[name])
+		}
+		if caps["node4"] <= caps[name] {
+			t.Errorf("heavy member cap %v not above %s cap %v", caps["node4"], name, caps[name])
+		}
+	}
+
+	// Count how often each member is chosen as the first replica, relative to
+	// the number of partitions it does not own.
+	replicas := make(map[string]int)
+	notOwned := make(map[string]int)
+	for partID := 0; partID < cfg.PartitionCount; partID++ {
+		closest, err := c.GetClosestNForPartition(partID, 2)
+		if err != nil {
+			t.Fatalf("GetClosestNForPartition returned error: %v", err)
+		}
+		if len(closest) != 2 || closest[0].String() == closest[1].String() {
+			t.Fatalf("expected 2 distinct members, got %v", closest)
+		}
+		replicas[closest[1].String()]++
+		for _, m := range members {
+			if m.String() != closest[0].String() {
+				notOwned[m.String()]++
+			}
+		}
+	}
+	rate := func(name string) float64 {
+		return float64(replicas[name]) / float64(notOwned[name])
+	}
+	for _, name := range []string{"node1", "node2", "node3"} {
+		if rate("node4") <= rate(name) {
+			t.Errorf("heavy member replica rate %v not above %s rate %v", rate("node4"), name, rate(name))
+		}
+	}
+}
+
+func TestConsistentRemoveWhere(t *testing.T) {
+	members := []Member{
+		testMember("zone-a/node1"),
+		testMember("zone-a/node2"),
+		testMember("zone-b/node1"),
+		testMember("zone-b/node2"),
+	}
+	c := New(members, newConfig())
+
+	removed := c.RemoveWhere(func(name string) bool {
+		return strings.HasPrefix(name, "zone-a/")
+	})
+	if removed != 2 {
+		t.Fatalf("RemoveWhere removed %d members, want 2", removed)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate() after RemoveWhere returned %v", err)
+	}
+	for partID := 0; partID < 23; partID++ {
+		if owner := c.GetPartitionOwner(partID); !strings.HasPrefix(owner.String(), "zone-b/") {
+			t.Fatalf("partition %d owned by %v after evacuating zone-a", partID, owner)
+		}
+	}
+
+	if removed := c.RemoveWhere(func(string) bool { return false }); removed != 0 {
+		t.Fatalf("RemoveWhere removed %d members, want 0", removed)
+	}
+
+	if removed := c.RemoveWhere(func(string) bool { return true }); removed != 2 {
+		t.Fatalf("RemoveWhere removed %d members, want 2", removed)
+	}
+	if len(c.GetMembers()) != 0 || c.GetPartitionOwner(0) != nil {
+		t.Fatalf("ring not empty after removing every member")
+	}
+}
+
+func TestConsistentSetMembers(t *testing.T) {
+	c := New([]Member{testMember("node1"), testMember("node2"), testMember("node3")}, newConfig())
+
+	added, removed := c.SetMembers([]Member{testMember("node2"), testMember("node4"), testMember("node5"), testMember("node4")})
+	if added != 2 || removed != 2 {
+		t.Errorf("SetMembers() = %d added, %d removed, want 2 and 2", added, removed)
+	}
+	var names []string
+	for _, m := range c.GetMembers() {
+		names = append(names, m.String())
+	}
+	sort.Strings(names)
+	if want := []string{"node2", "node4", "node5"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("members = %v, want %v", names, want)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate() after SetMembers returned %v", err)
+	}
+
+	// The result matches a ring built from the same set.
+	fresh := New([]Member{testMember("node2"), testMember("node4"), testMember("node5")}, newConfig())
+	for partID := 0; partID < 23; partID++ {
+		if got, want := c.GetPartitionOwner(partID), fresh.GetPartitionOwner(partID); got.String() != want.String() {
+			t.Fatalf("partition %d owned by %v, want %v", partID, got, want)
+		}
+	}
+
+	if added, removed := c.SetMembers([]Member{testMember("node5"), testMember("node4"), testMember("node2")}); added != 0 || removed != 0 {
+		t.Errorf("SetMembers() with the same set = %d, %d, want no changes", added, removed)
+	}
+	if added, removed := c.SetMembers(nil); added != 0 || removed != 3 {
+		t.Errorf("SetMembers(nil) = %d, %d, want 3 removed", added, removed)
+	}
+	if got := c.LocateKey([]byte("key")); got != nil {
+		t.Errorf("LocateKey() on emptied ring = %v, want nil", got)
+	}
+}
+
+func TestConsistentSetMembersCtx(t *testing.T) {
+	c := New([]Member{testMember("node1"), testMember("node2")}, newConfig())
+	before := c.ExportRoutingTable()
+	points := c.sortedSet.Len()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.SetMembersCtx(ctx, []Member{testMember("node2"), testMember("node3")}); err != context.Canceled {
+		t.Fatalf("SetMembersCtx() with a cancelled context returned %v, want context.Canceled", err)
+	}
+	if after := c.ExportRoutingTable(); !reflect.DeepEqual(after, before) {
+		t.Errorf("cancelled SetMembersCtx() changed the routing table from %v to %v", before, after)
+	}
+	if c.sortedSet.Len() != points || len(c.GetMembers()) != 2 {
+		t.Errorf("cancelled SetMembersCtx() changed the ring")
+	}
+
+	if err := c.SetMembersCtx(context.Background(), []Member{testMember("node2"), testMember("node3")}); err != nil {
+		t.Fatalf("SetMembersCtx() returned %v", err)
+	}
+	fresh := New([]Member{testMember("node2"), testMember("node3")}, newConfig())
+	for partID := 0; partID < 23; partID++ {
+		if got, want := c.GetPartitionOwner(partID), fresh.GetPartitionOwner(partID); got.String() != want.String() {
+			t.Fatalf("partition %d owned by %v, want %v", partID, got, want)
+		}
+	}
+}
+
+func TestConsistentGetPrimaryAndBackup(t *testing.T) {
+	c := New([]Member{testMember("node1")}, newConfig())
+	if _, _, err := c.GetPrimaryAndBackup([]byte("key")); err != ErrInsufficientMemberCount {
+		t.Fatalf("expected ErrInsufficientMemberCount, got %v", err)
+	}
+
+	c.Add(testMember("node2"))
+	c.Add(testMember("node3"))
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		primary, backup, err := c.GetPrimaryAndBackup(key)
+		if err != nil {
+			t.Fatalf("GetPrimaryAndBackup returned error: %v", err)
+		}
+		if primary.String() != c.LocateKey(key).String() {
+			t.Errorf("primary %s is not the key owner %s", primary, c.LocateKey(key))
+		}
+		if backup == nil || backup.String() == primary.String() {
+			t.Errorf("backup %v must differ from primary %s", backup, primary)
+		}
+	}
+}
+
+func benchmarkReplicas(b *testing.B, lookup func(c *Consistent, key []byte)) {
+	members := make([]Member, 50)
+	for i := range members {
+		members[i] = testMember(fmt.Sprintf("node%d", i))
+	}
+	cfg := newConfig()
+	cfg.PartitionCount = 271
+	c := New(members, cfg)
+	key := []byte("Hello World!")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lookup(c, key)
+	}
+}
+
+func BenchmarkGetPrimaryAndBackup(b *testing.B) {
+	benchmarkReplicas(b, func(c *Consistent, key []byte) { c.GetPrimaryAndBackup(key) })
+}
+
+func BenchmarkGetClosestN2(b *testing.B) {
+	benchmarkReplicas(b, func(c *Consistent, key []byte) { c.GetClosestN(key, 2) })
+}
+
+// batchKeys is the batch routed by the GetClosestN batch benchmarks.
+var batchKeys = func() [][]byte {
+	keys := make([][]byte, 100)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%d", i))
+	}
+	return keys
+}()
+
+func BenchmarkGetClosestN3Loop(b *testing.B) {
+	benchmarkReplicas(b, func(c *Consistent, _ []byte) {
+		for _, key := range batchKeys {
+			c.GetClosestN(key, 3)
+		}
+	})
+}
+
+func BenchmarkGetClosestNBatch3(b *testing.B) {
+	benchmarkReplicas(b, func(c *Consistent, _ []byte) { c.GetClosestNBatch(batchKeys, 3) })
+}
+
+func TestConsistentGetReplicas(t *testing.T) {
+	members := []Member{testMember("node1"), testMember("node2"), testMember("node3")}
+	key := []byte("Olric")
+
+	testCases := []struct {
+		name    string
+		count   int
+		wantErr error
+	}{
+		{name: "unset", count: 0, wantErr: ErrInvalidConfig},
+		{name: "one", count: 1},
+		{name: "all members", count: 3},
+		{name: "too many", count: 4, wantErr: ErrInsufficientMemberCount},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := newConfig()
+			cfg.DefaultReplicaCount = tc.count
+			c := New(members, cfg)
+
+			got, err := c.GetReplicas(key)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("GetReplicas() returned %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr != nil {
+				return
+			}
+			want, err := c.GetClosestN(key, tc.count)
+			if err != nil {
+				t.Fatalf("GetClosestN() returned %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("GetReplicas() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestConsistentGetClosestNBatch(t *testing.T) {
+	members := []Member{testMember("node1"), testMember("node2"), weightedMember{"node3", 2}, testMember("node4")}
+	c := New(members, newConfig())
+
+	got, err := c.GetClosestNBatch(batchKeys, 3)
+	if err != nil {
+		t.Fatalf("GetClosestNBatch() returned %v", err)
+	}
+	if len(got) != len(batchKeys) {
+		t.Fatalf("GetClosestNBatch() returned %d results, want %d", len(got), len(batchKeys))
+	}
+	for i, key := range batchKeys {
+		want, err := c.GetClosestN(key, 3)
+		if err != nil {
+			t.Fatalf("GetClosestN() returned %v", err)
+		}
+		if !reflect.DeepEqual(got[i], want) {
+			t.Fatalf("GetClosestNBatch() for %s = %v, want %v", key, got[i], want)
+		}
+	}
+
+	if _, err := c.GetClosestNBatch(batchKeys, 5); err != ErrInsufficientMemberCount {
+		t.Errorf("GetClosestNBatch() with too few members returned %v, want ErrInsufficientMemberCount", err)
+	}
+}
+
+func TestConsistentNewWithError(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(cfg *Config)
+		wantErr error
+	}{
+		{name: "valid", modify: func(cfg *Config) {}},
+		{name: "defaults", modify: func(cfg *Config) { *cfg = Config{HashFunc: hashFunc{}} }},
+		{name: "nil hash func", modify: func(cfg *Config) { cfg.HashFunc = nil }, wantErr: ErrNilHashFunc},
+		{name: "negative partition count", modify: func(cfg *Config) { cfg.PartitionCount = -1 }, wantErr: ErrInvalidConfig},
+		{name: "negative replication factor", modify: func(cfg *Config) { cfg.ReplicationFactor = -1 }, wantErr: ErrInvalidConfig},
+		{name: "load below one", modify: func(cfg *Config) { cfg.Load = 0.5 }, wantErr: ErrInvalidConfig},
+		{name: "NaN load", modify: func(cfg *Config) { cfg.Load = math.NaN() }, wantErr: ErrInvalidConfig},
+		{name: "negative expected members", modify: func(cfg *Config) { cfg.ExpectedMembers = -1 }, wantErr: ErrInvalidConfig},
+		{name: "unbounded", modify: func(cfg *Config) { cfg.DisableBoundedLoad = true }},
+		{name: "unbounded with strategy", modify: func(cfg *Config) {
+			cfg.DisableBoundedLoad = true
+			cfg.Strategy = TwoChoices{}
+		}, wantErr: ErrInvalidConfig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newConfig()
+			tt.modify(&cfg)
+			c, err := NewWithError([]Member{testMember("node1")}, cfg)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewWithError() error = %v, want %v", err, tt.wantErr)
+			}
+			if (c == nil) != (tt.wantErr != nil) {
+				t.Fatalf("NewWithError() = %v with error %v", c, err)
+			}
+		})
+	}
+
+	// Five members cannot share three partitions: the cap is 0 per member.
+	var members []Member
+	for i := 0; i < 5; i++ {
+		members = append(members, testMember(fmt.Sprintf("node%d", i)))
+	}
+	cfg := newConfig()
+	cfg.PartitionCount = 3
+	c, err := NewWithError(members, cfg)
+	var de *DistributionError
+	if !errors.As(err, &de) || c != nil {
+		t.Fatalf("NewWithError() with too few partitions = %v, %v, want a *DistributionError", c, err)
+	}
+	if de.Members != 5 || de.Partitions != 3 {
+		t.Errorf("DistributionError = %+v, want 5 members and 3 partitions", de)
+	}
+}
+
+func TestConsistentNewPanics(t *testing.T) {
+	defer func() {
+		if r := recover(); r != ErrNilHashFunc {
+			t.Errorf("New() panicked with %v, want ErrNilHashFunc", r)
+		}
+	}()
+	New(nil, Config{})
+}
+
+func TestConsistentDistributionError(t *testing.T) {
+	cfg := newConfig()
+	cfg.Load = 1
+	defer func() {
+		err, ok := recover().(*DistributionError)
+		if !ok {
+			t.Fatalf("New() did not panic with a *DistributionError")
+		}
+		want := DistributionError{Members: 2, Partitions: 23, Load: 1, Cap: 11}
+		if *err != want {
+			t.Errorf("DistributionError = %+v, want %+v", *err, want)
+		}
+		if !strings.Contains(err.Error(), "increase the load factor") {
+			t.Errorf("Error() = %q, want a remediation hint", err.Error())
+		}
+	}()
+	New([]Member{testMember("node1"), testMember("node2")}, cfg)
+}
+
+// clockwise assigns each partition to the first member clockwise from its
+// hash, ignoring load.
+type clockwise struct{}
+
+func (clockwise) Assign(partID, idx int, ring *RingView) Member {
+	return ring.Owner(idx)
+}
+
+func TestConsistentStrategy(t *testing.T) {
+	members := []Member{testMember("node1"), testMember("node2"), testMember("node3")}
+
+	def := New(members, newConfig())
+	cfg := newConfig()
+	cfg.Strategy = BoundedLoad{}
+	explicit := New(members, cfg)
+	for partID := 0; partID < 23; partID++ {
+		if def.GetPartitionOwner(partID) != explicit.GetPartitionOwner(partID) {
+			t.Fatalf("partition %d: default strategy differs from BoundedLoad", partID)
+		}
+	}
+
+	cfg.Strategy = clockwise{}
+	c := New(members, cfg)
+	bs := make([]byte, 8)
+	for partID := 0; partID < 23; partID++ {
+		binary.LittleEndian.PutUint64(bs, uint64(partID))
+		key := cfg.HashFunc.Sum64(bs)
+		idx := c.sortedSet.Search(key)
+		if idx >= c.sortedSet.Len() {
+			idx = 0
+		}
+		if want := *c.ring[c.sortedSet.At(idx)]; c.GetPartitionOwner(partID) != want {
+			t.Errorf("partition %d owned by %v, want clockwise owner %v", partID, c.GetPartitionOwner(partID), want)
+		}
+	}
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate() with custom strategy returned %v", err)
+	}
+}
+
+func TestConsistentDisableBoundedLoad(t *testing.T) {
+	members := []Member{testMember("node1"), testMember("node2"), testMember("node3")}
+	bounded := New(members, newConfig())
+	cfg := newConfig()
+	cfg.DisableBoundedLoad = true
+	classic := New(members, cfg)
+
+	var differ int
+	for partID := 0; partID < 23; partID++ {
+		bs := make([]byte, 8)
+		binary.LittleEndian.PutUint64(bs, uint64(partID))
+		idx := classic.sortedSet.Search(classic.hashFunc.Sum64(bs)) % classic.sortedSet.Len()
+		if want := *classic.ring[classic.sortedSet.At(idx)]; classic.GetPartitionOwner(partID) != want {
+			t.Errorf("partition %d owned by %v, want clockwise owner %v", partID, classic.GetPartitionOwner(partID), want)
+		}
+		if bounded.GetPartitionOwner(partID) != classic.GetPartitionOwner(partID) {
+			differ++
+		}
+	}
+	if differ == 0 {
+		t.Error("bounded and classic modes assign every partition alike, want bounded load to move some")
+	}
+
+	var total float64
+	var overCap bool
+	for _, load := range classic.LoadDistribution() {
+		total += load
+		overCap = overCap || load > classic.AverageLoad()
+	}
+	if total != 23 {
+		t.Errorf("classic loads sum to %v, want 23", total)
+	}
+	if !overCap {
+		t.Error("classic mode kept every member under the bounded-load cap, want the test to exercise overflow")
+	}
+
+	// Configuration round-trips through New.
+	if _, err := NewWithError(members, classic.Configuration()); err != nil {
+		t.Errorf("NewWithError(Configuration()) returned %v", err)
+	}
+}
+
+func TestConsistentPin(t *testing.T) {
+	members := []Member{testMember("node1"), testMember("node2"), testMember("node3")}
+	c := New(members, newConfig())
+
+	key := []byte("legacy-key")
+	owner := c.LocateKey(key)
+	var target string
+	for _, m := range members {
+		if m.String() != owner.String() {
+			target = m.String()
+			break
+		}
+	}
+
+	if err := c.Pin(key, "unknown"); err != ErrMemberNotFound {
+		t.Fatalf("Pin() to unknown member returned %v, want ErrMemberNotFound", err)
+	}
+	if err := c.Pin(key, target); err != nil {
+		t.Fatalf("Pin() returned %v", err)
+	}
+	if got := c.LocateKey(key); got.String() != target {
+		t.Fatalf("LocateKey() = %v, want pinned member %s", got, target)
+	}
+
+	// Replica APIs put the pinned member first.
+	closest, err := c.GetClosestN(key, 3)
+	if err != nil || closest[0].String() != target || len(closest) != 3 {
+		t.Fatalf("GetClosestN() of pinned key = %v, %v, want %s first", closest, err, target)
+	}
+	if closest[1].String() == target || closest[2].String() == target || closest[1].String() == closest[2].String() {
+		t.Fatalf("GetClosestN() of pinned key repeats a member: %v", closest)
+	}
+	if batch, err := c.GetClosestNBatch([][]byte{key}, 2); err != nil || batch[0][0].String() != target {
+		t.Fatalf("GetClosestNBatch() of pinned key = %v, %v, want %s first", batch, err, target)
+	}
+	primary, backup, err := c.GetPrimaryAndBackup(key)
+	if err != nil || primary.String() != target || backup.String() == target {
+		t.Fatalf("GetPrimaryAndBackup() of pinned key = %v, %v, %v, want primary %s", primary, backup, err, target)
+	}
+
+	// Pins survive rebalances.
+	c.Add(testMember("node4"))
+	if got := c.LocateKey(key); got.String() != target {
+		t.Fatalf("LocateKey() after Add = %v, want pinned member %s", got, target)
+	}
+
+	c.Unpin(key)
+	if got := c.LocateKey(key); got.String() != c.GetPartitionOwner(c.FindPartitionID(key)).String() {
+		t.Fatalf("LocateKey() after Unpin = %v, want partition owner", got)
+	}
+
+	// Pins are dropped with their member.
+	if err := c.Pin(key, target); err != nil {
+		t.Fatalf("Pin() returned %v", err)
+	}
+	c.Remove(target)
+	if got := c.LocateKey(key); got == nil || got.String() == target {
+		t.Fatalf("LocateKey() after removing pinned member = %v", got)
+	}
+}
+
+func TestConsistentGroupKeysByOwner(t *testing.T) {
+	c := New(nil, newConfig())
+	if groups := c.GroupKeysByOwner([][]byte{[]byte("key")}); groups == nil || len(groups) != 0 {
+		t.Fatalf("GroupKeysByOwner() on empty ring = %v, want empty map", groups)
+	}
+
+	members := []Member{testMember("node1"), testMember("node2"), testMember("node3")}
+	c = New(members, newConfig())
+	keys := make([][]byte, 1000)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%d", i))
+	}
+	if err := c.Pin(keys[0], "node1"); err != nil {
+		t.Fatalf("Pin() returned %v", err)
+	}
+
+	groups := c.GroupKeysByOwner(keys)
+	var total int
+	for owner, group := range groups {
+		total += len(group)
+		for _, key := range group {
+			if got := c.LocateKey(key).String(); got != owner {
+				t.Fatalf("key %s grouped under %s, LocateKey() = %s", key, owner, got)
+			}
+		}
+	}
+	if total != len(keys) {
+		t.Errorf("GroupKeysByOwner() grouped %d keys, want %d", total, len(keys))
+	}
+	if string(groups["node1"][0]) != "key0" {
+		t.Errorf("first node1 key = %s, want pinned key0", groups["node1"][0])
+	}
+}
+
+func TestConsistentImportPartitionTable(t *testing.T) {
+	members := []Member{testMember("node1"), testMember("node2"), testMember("node3")}
+	c := New(members, newConfig())
+	resolve := func(name string) Member {
+		// The foreign library names members "host-N".
+		return testMember(strings.Replace(name, "host-", "node", 1))
+	}
+
+	// Everything on host-1 exceeds the load cap but is imported as is.
+	table := make(map[int]string)
+	for partID := 0; partID < 23; partID++ {
+		table[partID] = "host-1"
+	}
+	table[5] = "host-2"
+	if err := c.ImportPartitionTable(table, resolve); err != nil {
+		t.Fatalf("ImportPartitionTable() returned %v", err)
+	}
+	for partID, name := range table {
+		if got, want := c.GetPartitionOwner(partID).String(), resolve(name).String(); got != want {
+			t.Fatalf("partition %d owned by %s, want %s", partID, got, want)
+		}
+	}
+	if load := c.LoadDistribution()["node1"]; load != 22 {
+		t.Errorf("node1 load = %v, want 22", load)
+	}
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate() after import returned %v", err)
+	}
+
+	table[5] = "host-9"
+	if err := c.ImportPartitionTable(table, resolve); !errors.Is(err, ErrMemberNotFound) {
+		t.Errorf("import with unknown owner returned %v, want ErrMemberNotFound", err)
+	}
+	table[5] = "host-2"
+	table[23] = "host-2"
+	if err := c.ImportPartitionTable(table, resolve); !errors.Is(err, ErrInvalidPartitionTable) {
+		t.Errorf("import with too many partitions returned %v, want ErrInvalidPartitionTable", err)
+	}
+	delete(table, 0)
+	if err := c.ImportPartitionTable(table, resolve); !errors.Is(err, ErrInvalidPartitionTable) {
+		t.Errorf("import with partition out of range returned %v, want ErrInvalidPartitionTable", err)
+	}
+	if got := c.GetPartitionOwner(5).String(); got != "node2" {
+		t.Errorf("failed import changed partition 5 owner to %s", got)
+	}
+
+	// The next rebalance restores bounded load.
+	c.Add(testMember("node4"))
+	for name, load := range c.LoadDistribution() {
+		if load > c.AverageLoad() {
+			t.Errorf("%s load %v exceeds cap %v after rebalance", name, load, c.AverageLoad())
+		}
+	}
+}
+
+func TestConsistentFractionalWeights(t *testing.T) {
+	members := []Member{
+		testMember("node1"),
+		fractionalMember{"node2", 1.5},
+		fractionalMember{"node3", 2.7},
+		weightedMember{"node4", 2},
+	}
+	cfg := newConfig()
+	cfg.HashFunc = mixedHashFunc{}
+	cfg.PartitionCount = 7919
+	cfg.ReplicationFactor = 100
+	cfg.Load = 1.1
+	c := New(members, cfg)
+
+	if got := c.sortedSet.Len(); got != 100+150+270+200 {
+		t.Errorf("ring has %d points, want %d", got, 100+150+270+200)
+	}
+	const totalWeight = 1 + 1.5 + 2.7 + 2
+	if c.totalWeight != totalWeight {
+		t.Errorf("total weight = %v, want %v", c.totalWeight, totalWeight)
+	}
+	loads := c.LoadDistribution()
+	for _, member := range members {
+		want := weightOf(member) / totalWeight
+		got := loads[member.String()] / float64(cfg.PartitionCount)
+		if math.Abs(got-want) > 0.15*want {
+			t.Errorf("%s owns %.3f of the partitions, want about %.3f", member, got, want)
+		}
+		if limit := math.Ceil(float64(cfg.PartitionCount/len(members)) * cfg.Load * weightOf(member) * 4 / totalWeight); c.LoadCaps()[member.String()] != limit {
+			t.Errorf("%s cap = %v, want %v", member, c.LoadCaps()[member.String()], limit)
+		}
+	}
+
+	c.Remove("node3")
+	if c.totalWeight != 1+1.5+2 {
+		t.Errorf("total weight after Remove = %v, want %v", c.totalWeight, 1+1.5+2)
+	}
+}
+
+func TestConsistentSeed(t *testing.T) {
+	var members []Member
+	for i := 0; i < 10; i++ {
+		members = append(members, testMember(fmt.Sprintf("node%d", i)))
+	}
+	newRing := func(seed uint64) *Consistent {
+		cfg := newConfig()
+		cfg.PartitionCount = 271
+		cfg.Seed = seed
+		return New(members, cfg)
+	}
+
+	unseeded, zero := New(members, Config{HashFunc: hashFunc{}, PartitionCount: 271, ReplicationFactor: 20, Load: 1.25}), newRing(0)
+	a, b := newRing(1), newRing(2)
+	var differ int
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		if zero.LocateKey(key).String() != unseeded.LocateKey(key).String() {
+			t.Fatalf("seed 0 changed the owner of %s", key)
+		}
+		if a.LocateKey(key).String() != b.LocateKey(key).String() {
+			differ++
+		}
+	}
+	if differ < 500 {
+		t.Errorf("only %d of 1000 keys placed differently by seeds 1 and 2", differ)
+	}
+
+	for _, c := range []*Consistent{a, b} {
+		loads := c.LoadDistribution()
+		if len(loads) != len(members) {
+			t.Errorf("%d members own partitions, want %d", len(loads), len(members))
+		}
+		for name, load := range loads {
+			if load > c.AverageLoad() {
+				t.Errorf("%s load %v exceeds cap %v", name, load, c.AverageLoad())
+			}
+		}
+		if err := c.Validate(); err != nil {
+			t.Errorf("Validate() returned %v", err)
+		}
+	}
+}
+
+func TestConsistentRemoveLastMember(t *testing.T) {
+	for _, impl := range []RingImpl{SliceRing, TreeRing} {
+		cfg := newConfig()
+		cfg.RingImpl = impl
+		c := New(nil, cfg)
+		c.Add(testMember("node1"))
+		c.Remove("node1")
+
+		if load := c.LoadDistribution(); len(load) != 0 {
+			t.Errorf("LoadDistribution() = %v, want empty", load)
+		}
+		if points := c.RingPoints(); len(points) != 0 {
+			t.Errorf("RingPoints() = %v, want empty", points)
+		}
+		if members := c.GetMembers(); len(members) != 0 {
+			t.Errorf("GetMembers() = %v, want empty", members)
+		}
+		if c.sortedSet.Len() != 0 || len(c.ring) != 0 || len(c.partitions) != 0 {
+			t.Errorf("ring not reset: %d points, %d ring entries, %d partitions", c.sortedSet.Len(), len(c.ring), len(c.partitions))
+		}
+		if owner := c.LocateKey([]byte("key")); owner != nil {
+			t.Errorf("LocateKey() = %v, want nil", owner)
+		}
+	}
+}
+
+func TestConsistentEpoch(t *testing.T) {
+	if got := New(nil, newConfig()).Epoch(); got != 0 {
+		t.Fatalf("Epoch() of an empty ring = %d, want 0", got)
+	}
+	c := New([]Member{testMember("node1")}, newConfig())
+	if got := c.Epoch(); got != 1 {
+		t.Fatalf("Epoch() of a new ring = %d, want 1", got)
+	}
+
+	testCases := []struct {
+		name   string
+		change func()
+		delta  uint64
+	}{
+		{name: "add", change: func() { c.Add(testMember("node2")) }, delta: 1},
+		{name: "add existing", change: func() { c.Add(testMember("node2")) }, delta: 0},
+		{name: "remove", change: func() { c.Remove("node2") }, delta: 1},
+		{name: "remove unknown", change: func() { c.Remove("node9") }, delta: 0},
+		{name: "set members", change: func() { c.SetMembers([]Member{testMember("node1"), testMember("node3")}) }, delta: 1},
+		{name: "set same members", change: func() { c.SetMembers([]Member{testMember("node3"), testMember("node1")}) }, delta: 0},
+		{name: "lookup", change: func() { c.LocateKey([]byte("key")) }, delta: 0},
+		{name: "remove last", change: func() { c.SetMembers(nil) }, delta: 1},
+	}
+	for _, tc := range testCases {
+		before := c.Epoch()
+		tc.change()
+		if got := c.Epoch(); got != before+tc.delta {
+			t.Errorf("%s: Epoch() = %d, want %d", tc.name, got, before+tc.delta)
+		}
+	}
+}
+
+func TestConsistentSatisfiesBoundedLoad(t *testing.T) {
+	if ok, msg := New(nil, newConfig()).SatisfiesBoundedLoad(); !ok || msg != "" {
+		t.Errorf("SatisfiesBoundedLoad() on empty ring = %v, %q", ok, msg)
+	}
+
+	members := []Member{testMember("node1"), testMember("node2"), testMember("node3")}
+	c := New(members, newConfig())
+	if ok, msg := c.SatisfiesBoundedLoad(); !ok || msg != "" {
+		t.Errorf("SatisfiesBoundedLoad() after distribution = %v, %q", ok, msg)
+	}
+
+	// 20 partitions on node2 and 3 on node3 against a cap of 9 each.
+	table := make(map[int]string)
+	for partID := 0; partID < 23; partID++ {
+		table[partID] = "node2"
+	}
+	table[0], table[1], table[2] = "node3", "node3", "node3"
+	if err := c.ImportPartitionTable(table, func(name string) Member { return testMember(name) }); err != nil {
+		t.Fatalf("ImportPartitionTable() returned %v", err)
+	}
+	ok, msg := c.SatisfiesBoundedLoad()
+	if want := "node2 owns 20 partitions, 11 over its cap of 9"; ok || msg != want {
+		t.Errorf("SatisfiesBoundedLoad() after import = %v, %q, want false, %q", ok, msg, want)
+	}
+
+	c.Add(testMember("node4"))
+	if ok, msg := c.SatisfiesBoundedLoad(); !ok {
+		t.Errorf("SatisfiesBoundedLoad() after rebalance = false, %q", msg)
+	}
+}
+
+func TestConsistentExportRoutingTable(t *testing.T) {
+	c := New(nil, newConfig())
+	empty := c.ExportRoutingTable()
+	if len(empty.Owners) != 0 || empty.PartitionCount != 23 {
+		t.Fatalf("ExportRoutingTable() on empty ring = %+v", empty)
+	}
+
+	c.Add(testMember("node1"))
+	c.Add(testMember("node2"))
+	table := c.ExportRoutingTable()
+	if table.PartitionCount != 23 || len(table.Owners) != 23 {
+		t.Fatalf("ExportRoutingTable() has %d owners for %d partitions, want 23", len(table.Owners), table.PartitionCount)
+	}
+	if table.Epoch <= empty.Epoch {
+		t.Errorf("epoch %d did not grow from %d", table.Epoch, empty.Epoch)
+	}
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		partID := int(hashFunc{}.Sum64(key) % uint64(table.PartitionCount))
+		if got, want := table.Owners[partID], c.LocateKey(key).String(); got != want {
+			t.Fatalf("routing table owner of %s = %s, want %s", key, got, want)
+		}
+	}
+
+	if again := c.ExportRoutingTable(); again.Epoch != table.Epoch {
+		t.Errorf("epoch changed from %d to %d without a rebalance", table.Epoch, again.Epoch)
+	}
+	c.Remove("node2")
+	if after := c.ExportRoutingTable(); after.Epoch <= table.Epoch {
+		t.Errorf("epoch %d did not grow from %d after Remove", after.Epoch, table.Epoch)
+	}
+}
+
+func TestConsistentHotMember(t *testing.T) {
+	c := New(nil, newConfig())
+	if member, count := c.HotMember([][]byte{[]byte("key")}); member != nil || count != 0 {
+		t.Fatalf("HotMember() on empty ring = %v, %d", member, count)
+	}
+
+	members := []Member{testMember("node1"), testMember("node2"), testMember("node3")}
+	c = New(members, newConfig())
+
+	// A skewed sample: one key repeated many times plus a few others.
+	hotKey := []byte("hot-key")
+	keys := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	for i := 0; i < 10; i++ {
+		keys = append(keys, hotKey)
+	}
+
+	member, count := c.HotMember(keys)
+	if member.String() != c.LocateKey(hotKey).String() {
+		t.Errorf("HotMember() = %v, want owner of the hot key %v", member, c.LocateKey(hotKey))
+	}
+	if count < 10 {
+		t.Errorf("HotMember() count = %d, want at least 10", count)
+	}
+}
+
+func TestRecommendPartitionCount(t *testing.T) {
+	if got := RecommendPartitionCount(0, 0.25); got != 0 {
+		t.Errorf("RecommendPartitionCount(0, 0.25) = %d, want 0", got)
+	}
+	if got := RecommendPartitionCount(3, 0); got != 0 {
+		t.Errorf("RecommendPartitionCount(3, 0) = %d, want 0", got)
+	}
+
+	for _, memberCount := range []int{1, 3, 10, 50} {
+		for _, maxImbalance := range []float64{0.1, 0.25, 0.5} {
+			partitionCount := RecommendPartitionCount(memberCount, maxImbalance)
+			if !isPrime(partitionCount) {
+				t.Errorf("RecommendPartitionCount(%d, %v) = %d is not prime", memberCount, maxImbalance, partitionCount)
+			}
+
+			members := make([]Member, memberCount)
+			for i := range members {
+				members[i] = testMember(fmt.Sprintf("node%d", i))
+			}
+			c := New(members, Config{
+				HashFunc:       hashFunc{},
+				PartitionCount: partitionCount,
+				Load:           1 + maxImbalance/2,
+			})
+			avg := float64(partitionCount) / float64(memberCount)
+			for member, load := range c.LoadDistribution() {
+				if load > avg*(1+maxImbalance) {
+					t.Errorf("members=%d imbalance=%v: %s owns %v partitions, average %v",
+						memberCount, maxImbalance, member, load, avg)
+				}
+			}
+		}
+	}
+}
+
+func TestConsistentRingPoints(t *testing.T) {
+	members := []Member{testMember("node1"), testMember("node2"), weightedMember{"node3", 2}}
+	cfg := newConfig()
+	c := New(members, cfg)
+
+	points := c.RingPoints()
+	if len(points) != 4*cfg.ReplicationFactor {
+		t.Fatalf("got %d ring points, want %d", len(points), 4*cfg.ReplicationFactor)
+	}
+	perOwner := make(map[string]int)
+	for i, p := range points {
+		if i > 0 && points[i-1].Hash >= p.Hash {
+			t.Fatalf("ring points not sorted at %d", i)
+		}
+		perOwner[p.Owner]++
+	}
+	if perOwner["node1"] != cfg.ReplicationFactor || perOwner["node3"] != 2*cfg.ReplicationFactor {
+		t.Errorf("unexpected ring points per owner: %v", perOwner)
+	}
+
+	// The result is a copy.
+	points[0].Owner = "changed"
+	if c.RingPoints()[0].Owner == "changed" {
+		t.Errorf("RingPoints() returned shared state")
+	}
+}
+
+func TestConsistentForHash(t *testing.T) {
+	members := []Member{testMember("node1"), testMember("node2"), testMember("node3")}
+	for _, seed := range []uint64{0, 42} {
+		for _, mapping := range []PartitionMapping{Modulo, MultiplyShift} {
+			cfg := newConfig()
+			cfg.PartitionMapping = mapping
+			cfg.HashFunc = mixedHashFunc{}
+			cfg.Seed = seed
+			c := New(members, cfg)
+			if got, plain := c.HashKey([]byte("key")), cfg.HashFunc.Sum64([]byte("key")); (got == plain) != (seed == 0) {
+				t.Fatalf("seed %d: HashKey() = %x, HashFunc gives %x", seed, got, plain)
+			}
+			for i := 0; i < 100; i++ {
+				key := []byte(fmt.Sprintf("key%d", i))
+				hKey := c.HashKey(key)
+				if got, want := c.FindPartitionIDForHash(hKey), c.FindPartitionID(key); got != want {
+					t.Fatalf("seed %d, mapping %d: FindPartitionIDForHash() = %d, want %d", seed, mapping, got, want)
+				}
+				if got, want := c.GetPartitionOwnerForHash(hKey), c.LocateKey(key); got.String() != want.String() {
+					t.Fatalf("seed %d, mapping %d: GetPartitionOwnerForHash() = %v, want %v", seed, mapping, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestConsistentLastRebalance(t *testing.T) {
+	c := New(nil, newConfig())
+	if d, moved := c.LastRebalance(); d != 0 || moved != 0 {
+		t.Errorf("LastRebalance() before any rebuild = %v, %d, want zeros", d, moved)
+	}
+
+	c.Add(testMember("node1"))
+	if d, moved := c.LastRebalance(); d <= 0 || moved != 23 {
+		t.Errorf("LastRebalance() after first Add = %v, %d, want positive duration and 23 moved", d, moved)
+	}
+
+	c.Add(testMember("node2"))
+	before := make(map[int]string)
+	for partID := 0; partID < 23; partID++ {
+		before[partID] = c.GetPartitionOwner(partID).String()
+	}
+	c.Add(testMember("node3"))
+	var want int
+	for partID := 0; partID < 23; partID++ {
+		if c.GetPartitionOwner(partID).String() != before[partID] {
+			want++
+		}
+	}
+	if _, moved := c.LastRebalance(); moved != want || moved == 0 {
+		t.Errorf("LastRebalance() moved = %d, want %d", moved, want)
+	}
+}
+
+func TestConsistentHistory(t *testing.T) {
+	cfg := newConfig()
+	cfg.HistorySize = 2
+	c := New([]Member{testMember("node1")}, cfg)
+	key := []byte("audited-key")
+	if got := c.LocateKeyAt(0, key); got == nil || got.String() != "node1" {
+		t.Fatalf("LocateKeyAt(0) = %v, want node1", got)
+	}
+
+	c.Remove("node1")
+	c.Add(testMember("node2"))
+	history := c.History()
+	if len(history) != 2 {
+		t.Fatalf("History() retained %d snapshots, want 2", len(history))
+	}
+	if got := c.LocateKeyAt(0, key); got != nil {
+		t.Errorf("LocateKeyAt(0) on the emptied ring = %v, want nil", got)
+	}
+	if got := c.LocateKeyAt(1, key); got == nil || got.String() != "node2" || history[1].MemberCount() != 1 {
+		t.Errorf("LocateKeyAt(1) = %v, want node2", got)
+	}
+	if got := c.LocateKeyAt(2, key); got != nil {
+		t.Errorf("LocateKeyAt() out of range = %v, want nil", got)
+	}
+
+	// Later rebalances do not change retained snapshots.
+	c.Add(testMember("node3"))
+	c.Add(testMember("node4"))
+	snapshot := c.History()[0]
+	c.Remove("node4")
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		if got := snapshot.LocateKey(key); got.String() == "node1" || got.String() == "node4" {
+			t.Fatalf("snapshot with node2 and node3 routed %s to %v", key, got)
+		}
+	}
+
+	if got := New([]Member{testMember("node1")}, newConfig()).History(); len(got) != 0 {
+		t.Errorf("History() without HistorySize = %d snapshots, want none", len(got))
+	}
+}
+
+func TestConsistentMigrationWindow(t *testing.T) {
+	cfg := newConfig()
+	cfg.MigrationWindow = time.Minute
+	now := time.Unix(1000, 0)
+	cfg.Now = func() time.Time { return now }
+	c := New([]Member{testMember("node1"), testMember("node2"), testMember("node3")}, cfg)
+
+	before := make(map[int]string)
+	for partID := 0; partID < 23; partID++ {
+		before[partID] = c.GetPartitionOwner(partID).String()
+	}
+	c.Add(testMember("node4"))
+
+	var moved int
+	for partID := 0; partID < 23; partID++ {
+		newOwner, oldOwner := c.GetPartitionOwnersDuringMigration(partID)
+		if newOwner.String() != c.GetPartitionOwner(partID).String() {
+			t.Fatalf("partition %d: new owner %v, want %v", partID, newOwner, c.GetPartitionOwner(partID))
+		}
+		if newOwner.String() == before[partID] {
+			if oldOwner != nil {
+				t.Errorf("partition %d did not move but reports old owner %v", partID, oldOwner)
+			}
+			continue
+		}
+		moved++
+		if oldOwner == nil || oldOwner.String() != before[partID] {
+			t.Errorf("partition %d: old owner %v, want %s", partID, oldOwner, before[partID])
+		}
+	}
+	if moved == 0 {
+		t.Fatal("adding a member moved no partitions")
+	}
+
+	// Once the window has passed, only the new owner is reported.
+	now = now.Add(time.Minute)
+	for partID := 0; partID < 23; partID++ {
+		if _, oldOwner := c.GetPartitionOwnersDuringMigration(partID); oldOwner != nil {
+			t.Fatalf("partition %d reports old owner %v after the window", partID, oldOwner)
+		}
+	}
+
+	// Old owners that left the ring are not reported.
+	c.Remove("node4")
+	for partID := 0; partID < 23; partID++ {
+		if _, oldOwner := c.GetPartitionOwnersDuringMigration(partID); oldOwner != nil && oldOwner.String() == "node4" {
+			t.Fatalf("partition %d reports removed node4 as old owner", partID)
+		}
+	}
+
+	if _, oldOwner := New(nil, newConfig()).GetPartitionOwnersDuringMigration(0); oldOwner != nil {
+		t.Errorf("empty ring reports old owner %v", oldOwner)
+	}
+}
+
+func TestConsistentGetPartitionOwners(t *testing.T) {
+	members := []Member{testMember("node1"), testMember("node2"), testMember("node3")}
+	c := New(members, newConfig())
+
+	partIDs := []int{22, 0, 7, -1, 23, 7}
+	owners := c.GetPartitionOwners(partIDs)
+	if len(owners) != len(partIDs) {
+		t.Fatalf("GetPartitionOwners() returned %d owners, want %d", len(owners), len(partIDs))
+	}
+	for i, partID := range partIDs {
+		want := c.GetPartitionOwner(partID)
+		if (owners[i] == nil) != (want == nil) || owners[i] != nil && owners[i].String() != want.String() {
+			t.Errorf("owner of partition %d = %v, want %v", partID, owners[i], want)
+		}
+	}
+	if owners[3] != nil || owners[4] != nil {
+		t.Errorf("unknown partitions resolved to %v and %v, want nil", owners[3], owners[4])
+	}
+}
+
+func TestConsistentRingLookup(t *testing.T) {
+	c := New(nil, newConfig())
+	if h, vnode, owner := c.RingLookup([]byte("key")); h != (hashFunc{}).Sum64([]byte("key")) || vnode != 0 || owner != nil {
+		t.Errorf("RingLookup() on empty ring = %d, %d, %v", h, vnode, owner)
+	}
+
+	c = New([]Member{testMember("node1"), testMember("node2"), testMember("node3")}, newConfig())
+	points := c.RingPoints()
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		h, vnode, owner := c.RingLookup(key)
+		if h != (hashFunc{}).Sum64(key) {
+			t.Fatalf("RingLookup(%s) key hash = %d, want %d", key, h, (hashFunc{}).Sum64(key))
+		}
+		// The owning point is the first one at or after the key hash,
+		// wrapping around to the first point.
+		want := points[0]
+		for _, p := range points {
+			if p.Hash >= h {
+				want = p
+				break
+			}
+		}
+		if vnode != want.Hash || owner.String() != want.Owner {
+			t.Fatalf("RingLookup(%s) = %d owned by %v, want %d owned by %s", key, vnode, owner, want.Hash, want.Owner)
+		}
+	}
+}
+
+func TestConsistentGetPartitionOwnerFallback(t *testing.T) {
+	c := New(nil, newConfig())
+	if _, err := c.GetPartitionOwnerFallback(0, func(Member) bool { return false }); err != ErrInsufficientMemberCount {
+		t.Fatalf("expected ErrInsufficientMemberCount on empty ring, got %v", err)
+	}
+
+	members := []Member{testMember("node1"), testMember("node2"), testMember("node3")}
+	c = New(members, newConfig())
+
+	for partID := 0; partID < 23; partID++ {
+		closest, err := c.GetClosestNForPartition(partID, 3)
+		if err != nil {
+			t.Fatalf("GetClosestNForPartition returned error: %v", err)
+		}
+		down := map[string]bool{}
+		isDown := func(m Member) bool { return down[m.String()] }
+
+		for i, want := range closest {
+			got, err := c.GetPartitionOwnerFallback(partID, isDown)
+			if err != nil || got.String() != want.String() {
+				t.Fatalf("partition %d with %d down: got %v (%v), want %v", partID, i, got, err, want)
+			}
+			down[want.String()] = true
+		}
+		if _, err := c.GetPartitionOwnerFallback(partID, isDown); err != ErrNoHealthyMember {
+			t.Fatalf("partition %d with every member down: got %v, want ErrNoHealthyMember", partID, err)
+		}
+	}
+
+	isDown := func(m Member) bool { return m.String() == "node1" }
+	for _, partID := range []int{-1, 23} {
+		if _, err := c.GetPartitionOwnerFallback(partID, isDown); err != ErrInvalidPartition {
+			t.Errorf("GetPartitionOwnerFallback(%d) returned %v, want ErrInvalidPartition", partID, err)
+		}
+		if _, err := c.GetClosestNForPartition(partID, 2); err != ErrInvalidPartition {
+			t.Errorf("GetClosestNForPartition(%d) returned %v, want ErrInvalidPartition", partID, err)
+		}
+	}
+}
+
+func TestConsistentLocateKeyHealthy(t *testing.T) {
+	c := New(nil, newConfig())
+	if _, err := c.LocateKeyHealthy([]byte("key"), func(Member) bool { return true }); err != ErrInsufficientMemberCount {
+		t.Fatalf("LocateKeyHealthy() on empty ring returned %v, want ErrInsufficientMemberCount", err)
+	}
+
+	members := []Member{testMember("node1"), testMember("node2"), testMember("node3"), testMember("node4")}
+	c = New(members, newConfig())
+	for i := 0; i < 50; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		closest, err := c.GetClosestN(key, 4)
+		if err != nil {
+			t.Fatalf("GetClosestN() returned %v", err)
+		}
+		down := map[string]bool{}
+		healthy := func(m Member) bool { return !down[m.String()] }
+
+		got, err := c.LocateKeyHealthy(key, healthy)
+		if err != nil || got.String() != c.LocateKey(key).String() {
+			t.Fatalf("LocateKeyHealthy(%s) with all healthy = %v, %v, want owner", key, got, err)
+		}
+
+		// The primary and the first replica are down.
+		down[closest[0].String()] = true
+		down[closest[1].String()] = true
+		got, err = c.LocateKeyHealthy(key, healthy)
+		if err != nil || got.String() != closest[2].String() {
+			t.Fatalf("LocateKeyHealthy(%s) = %v, %v, want second replica %v", key, got, err, closest[2])
+		}
+
+		for _, m := range members {
+			down[m.String()] = true
+		}
+		if _, err := c.LocateKeyHealthy(key, healthy); err != ErrNoHealthyMember {
+			t.Fatalf("LocateKeyHealthy(%s) with all down returned %v, want ErrNoHealthyMember", key, err)
+		}
+	}
+
+	key := []byte("pinned")
+	if err := c.Pin(key, "node3"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := c.LocateKeyHealthy(key, func(Member) bool { return true }); got.String() != "node3" {
+		t.Errorf("LocateKeyHealthy() for pinned key = %v, want node3", got)
+	}
+	notNode3 := func(m Member) bool { return m.String() != "node3" }
+	if got, _ := c.LocateKeyHealthy(key, notNode3); got == nil || got.String() == "node3" {
+		t.Errorf("LocateKeyHealthy() with pinned member down = %v", got)
+	}
+}
+
+func TestConsistentRand(t *testing.T) {
+	members := make([]Member, 8)
+	for i := range members {
+		members[i] = testMember(fmt.Sprintf("node%d", i))
+	}
+	table := func(strategy DistributionStrategy, r *rand.Rand) map[int]string {
+		cfg := newConfig()
+		cfg.PartitionCount = 271
+		cfg.HashFunc = mixedHashFunc{}
+		cfg.Strategy = strategy
+		cfg.Rand = r
+		return New(members, cfg).ExportRoutingTable().Owners
+	}
+
+	if !reflect.DeepEqual(table(TwoChoices{}, rand.New(rand.NewSource(1))), table(TwoChoices{}, rand.New(rand.NewSource(1)))) {
+		t.Errorf("TwoChoices with the same seed built different tables")
+	}
+	if reflect.DeepEqual(table(TwoChoices{}, rand.New(rand.NewSource(1))), table(TwoChoices{}, rand.New(rand.NewSource(2)))) {
+		t.Errorf("TwoChoices with different seeds built the same table")
+	}
+	if !reflect.DeepEqual(table(TwoChoices{}, nil), table(TwoChoices{}, nil)) {
+		t.Errorf("TwoChoices without Rand is not deterministic")
+	}
+	if !reflect.DeepEqual(table(BoundedLoad{}, nil), table(BoundedLoad{}, rand.New(rand.NewSource(1)))) {
+		t.Errorf("BoundedLoad depends on Rand")
+	}
+}
+
+func TestConsistentTwoChoices(t *testing.T) {
+	var boundedTail, twoChoicesTail float64
+	for round := 0; round < 20; round++ {
+		members := make([]Member, 8)
+		for i := range members {
+			members[i] = testMember(fmt.Sprintf("round%d-node%d", round, i))
+		}
+		cfg := newConfig()
+		cfg.PartitionCount = 271
+		cfg.HashFunc = mixedHashFunc{}
+
+		bounded := New(members, cfg)
+		cfg.Strategy = TwoChoices{}
+		twoChoices := New(members, cfg)
+		if err := twoChoices.Validate(); err != nil {
+			t.Fatalf("Validate() with TwoChoices returned %v", err)
+		}
+
+		boundedTail += bounded.Stats().MaxLoad
+		twoChoicesTail += twoChoices.Stats().MaxLoad
+		for member, load := range twoChoices.LoadDistribution() {
+			if load > twoChoices.LoadCap() {
+				t.Errorf("%s owns %v partitions, above cap %v", member, load, twoChoices.LoadCap())
+			}
+		}
+	}
+	if twoChoicesTail > boundedTail {
+		t.Errorf("TwoChoices mean max load %v above BoundedLoad %v", twoChoicesTail/20, boundedTail/20)
+	}
+	t.Logf("mean max load: BoundedLoad %v, TwoChoices %v", boundedTail/20, twoChoicesTail/20)
+}
+
+func TestConsistentTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := newConfig()
+	cfg.Now = func() time.Time { return now }
+	c := New([]Member{testMember("static")}, cfg)
+
+	c.AddWithTTL(testMember("node1"), time.Minute)
+	c.AddWithTTL(testMember("node2"), 2*time.Minute)
+	if len(c.GetMembers()) != 3 {
+		t.Fatalf("expected 3 members, got %v", c.GetMembers())
+	}
+
+	if removed := c.Tick(now.Add(30 * time.Second)); removed != 0 {
+		t.Fatalf("Tick() before any expiry removed %d members", removed)
+	}
+
+	// Refreshing node1 at 45s pushes its expiry to 1m45s.
+	now = now.Add(45 * time.Second)
+	if err := c.Refresh("node1"); err != nil {
+		t.Fatalf("Refresh() returned %v", err)
+	}
+	if err := c.Refresh("unknown"); err != ErrMemberNotFound {
+		t.Fatalf("Refresh() of unknown member returned %v", err)
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if removed := c.Tick(start.Add(time.Minute)); removed != 0 {
+		t.Fatalf("Tick() removed a refreshed member")
+	}
+	if removed := c.Tick(start.Add(2 * time.Minute)); removed != 2 {
+		t.Fatalf("Tick() after both TTLs lapsed removed %d members, want 2", removed)
+	}
+	members := c.GetMembers()
+	if len(members) != 1 || members[0].String() != "static" {
+		t.Fatalf("expected only the static member to remain, got %v", members)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate() after expiry returned %v", err)
+	}
+	if removed := c.Tick(start.Add(time.Hour)); removed != 0 {
+		t.Fatalf("Tick() removed a member without a TTL")
+	}
+}
+
+// pointCollisionHashFunc drops the digit after a leading "n", so the ring
+// points of members "n1", "n2" and "n3" collide while those of "other" and
+// the partitions do not.
+type pointCollisionHashFunc struct{}
+
+func (hs pointCollisionHashFunc) Sum64(data []byte) uint64 {
+	if len(data) > 1 && data[0] == 'n' && data[1] >= '1' && data[1] <= '3' {
+		return hashFunc{}.Sum64(append([]byte("n"), data[2:]...))
+	}
+	return hashFunc{}.Sum64(data)
+}
+
+func TestConsistentClosestNDistinct(t *testing.T) {
+	cfg := newConfig()
+	cfg.HashFunc = pointCollisionHashFunc{}
+	// Two members must be able to hold every partition.
+	cfg.Load = 4
+	members := []Member{testMember("n1"), testMember("n2"), testMember("n3"), testMember("other")}
+	c := New(members, cfg)
+
+	// Only "other" and one of the colliding members keep ring points, so at
+	// most two distinct members can be found.
+	for partID := 0; partID < 23; partID++ {
+		closest, err := c.GetClosestNForPartition(partID, 2)
+		if err != nil {
+			t.Fatalf("GetClosestNForPartition(%d, 2) returned %v", partID, err)
+		}
+		if closest[0].String() == closest[1].String() {
+			t.Fatalf("GetClosestNForPartition(%d, 2) returned duplicates: %v", partID, closest)
+		}
+
+		closest, err = c.GetClosestNForPartition(partID, 3)
+		if err != ErrInsufficientMemberCount {
+			t.Fatalf("GetClosestNForPartition(%d, 3) = %v, %v, want ErrInsufficientMemberCount", partID, closest, err)
+		}
+	}
+}
+
+func TestConsistentClosestNRingOrder(t *testing.T) {
+	var members []Member
+	for i := 0; i < 8; i++ {
+		members = append(members, testMember(fmt.Sprintf("node%d", i)))
+	}
+	cfg := newConfig()
+	cfg.DisableBoundedLoad = true
+	c := New(members, cfg)
+	points := c.RingPoints()
+
+	for partID := 0; partID < 23; partID++ {
+		// Without bounded load the owner is the first member clockwise, so
+		// the replicas are the distinct members in ring order.
+		bs := make([]byte, 8)
+		binary.LittleEndian.PutUint64(bs, uint64(partID))
+		partKey := hashFunc{}.Sum64(bs)
+		start := sort.Search(len(points), func(i int) bool { return points[i].Hash >= partKey })
+		var want []string
+		seen := make(map[string]bool)
+		for i := 0; len(want) < 5; i++ {
+			owner := points[(start+i)%len(points)].Owner
+			if !seen[owner] {
+				seen[owner] = true
+				want = append(want, owner)
+			}
+		}
+
+		closest, err := c.GetClosestNForPartition(partID, 5)
+		if err != nil {
+			t.Fatalf("GetClosestNForPartition(%d, 5) returned %v", partID, err)
+		}
+		var got []string
+		for _, m := range closest {
+			got = append(got, m.String())
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("GetClosestNForPartition(%d, 5) = %v, want ring order %v", partID, got, want)
+		}
+	}
+}
+
+func TestConsistentPrecomputeReplicas(t *testing.T) {
+	cfg := newConfig()
+	cfg.PrecomputeReplicas = 2
+	c := New([]Member{testMember("node1")}, cfg)
+	if got := c.GetPartitionReplicas(0); len(got) != 1 || got[0].String() != "node1" {
+		t.Fatalf("GetPartitionReplicas() with one member = %v", got)
+	}
+
+	c.Add(testMember("node2"))
+	c.Add(testMember("node3"))
+	check := func() {
+		t.Helper()
+		for partID := 0; partID < 23; partID++ {
+			want, err := c.GetClosestNForPartition(partID, 2)
+			if err != nil {
+				t.Fatalf("GetClosestNForPartition returned %v", err)
+			}
+			got := c.GetPartitionReplicas(partID)
+			if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+				t.Fatalf("partition %d: GetPartitionReplicas() = %v, want %v", partID, got, want)
+			}
+		}
+	}
+	check()
+	c.Remove("node1")
+	c.Add(testMember("node4"))
+	check()
+
+	if got := c.GetPartitionReplicas(-1); got != nil {
+		t.Errorf("GetPartitionReplicas(-1) = %v, want nil", got)
+	}
+	c.RemoveWhere(func(string) bool { return true })
+	if got := c.GetPartitionReplicas(0); got != nil {
+		t.Errorf("GetPartitionReplicas() on empty ring = %v, want nil", got)
+	}
+	if got := New([]Member{testMember("node1")}, newConfig()).GetPartitionReplicas(0); got != nil {
+		t.Errorf("GetPartitionReplicas() without PrecomputeReplicas = %v, want nil", got)
+	}
+}
+
+func BenchmarkGetPartitionReplicas(b *testing.B) {
+	members := make([]Member, 50)
+	for i := range members {
+		members[i] = testMember(fmt.Sprintf("node%d", i))
+	}
+	cfg := newConfig()
+	cfg.PartitionCount = 271
+	cfg.PrecomputeReplicas = 3
+	c := New(members, cfg)
+	key := []byte("Hello World!")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.GetPartitionReplicas(c.FindPartitionID(key))
+	}
+}
+
+func BenchmarkGetClosestN3(b *testing.B) {
+	benchmarkReplicas(b, func(c *Consistent, key []byte) { c.GetClosestN(key, 3) })
+}
+
+func TestConsistentConfiguration(t *testing.T) {
+	c := New(nil, Config{HashFunc: hashFunc{}, ExpectedMembers: 10})
+	cfg := c.Configuration()
+	if cfg.PartitionCount != DefaultPartitionCount ||
+		cfg.ReplicationFactor != DefaultReplicationFactor ||
+		cfg.Load != DefaultLoad {
+		t.Errorf("Configuration() = %+v, want defaults applied", cfg)
+	}
+	if cfg.HashFunc != (hashFunc{}) || cfg.ExpectedMembers != 10 {
+		t.Errorf("Configuration() = %+v, want caller values kept", cfg)
+	}
+	if _, ok := cfg.Strategy.(BoundedLoad); !ok {
+		t.Errorf("Configuration().Strategy = %T, want BoundedLoad", cfg.Strategy)
+	}
+
+	custom := newConfig()
+	if got := New(nil, custom).Configuration(); got.PartitionCount != 23 || got.Load != 1.25 {
+		t.Errorf("Configuration() = %+v, want %+v", got, custom)
+	}
+}
+
+func TestConsistentHeadroom(t *testing.T) {
+	members := []Member{testMember("node1"), testMember("node2"), weightedMember{"node3", 2}}
+	c := New(members, newConfig())
+
+	headroom := c.Headroom()
+	caps := c.LoadCaps()
+	loads := c.LoadDistribution()
+	if len(headroom) != 3 {
+		t.Fatalf("Headroom() = %v, want an entry per member", headroom)
+	}
+	for name, room := range headroom {
+		if room != caps[name]-loads[name] {
+			t.Errorf("%s: headroom %v, want cap %v - load %v", name, room, caps[name], loads[name])
+		}
+		if room < 0 {
+			t.Errorf("%s: negative headroom %v after a fresh rebalance", name, room)
+		}
+	}
+
+	c.Drain("node1")
+	if room := c.Headroom()["node1"]; room != 0 {
+		t.Errorf("draining member headroom = %v, want 0", room)
+	}
+}
+
+func TestConsistentLeastLoadedN(t *testing.T) {
+	c := New(nil, newConfig())
+	if got := c.LeastLoadedN(2); len(got) != 0 {
+		t.Errorf("LeastLoadedN() on empty ring = %v, want none", got)
+	}
+
+	members := []Member{testMember("node1"), testMember("node2"), weightedMember{"node3", 3}, testMember("node4")}
+	c = New(members, newConfig())
+	loads := c.LoadDistribution()
+
+	all := c.LeastLoadedN(10)
+	if len(all) != 4 {
+		t.Fatalf("LeastLoadedN(10) returned %d members, want 4", len(all))
+	}
+	for i := 1; i < len(all); i++ {
+		prev, cur := all[i-1].String(), all[i].String()
+		if loads[prev] > loads[cur] || loads[prev] == loads[cur] && prev > cur {
+			t.Fatalf("LeastLoadedN() = %v is not sorted by load then name (loads %v)", all, loads)
+		}
+	}
+	if all[len(all)-1].String() != "node3" {
+		t.Errorf("most loaded member = %v, want heavy node3", all[len(all)-1])
+	}
+	if got := c.LeastLoadedN(2); len(got) != 2 || got[0] != all[0] || got[1] != all[1] {
+		t.Errorf("LeastLoadedN(2) = %v, want prefix of %v", got, all)
+	}
+	if got := c.LeastLoadedN(0); got != nil {
+		t.Errorf("LeastLoadedN(0) = %v, want nil", got)
+	}
+
+	c.Drain(all[0].String())
+	if got := c.LeastLoadedN(1); got[0] == all[0] {
+		t.Errorf("LeastLoadedN(1) returned draining member %v", got[0])
+	}
+}
+
+func TestConsistentKeysMovedBetween(t *testing.T) {
+	c := New(nil, newConfig())
+	keys := make([][]byte, 1000)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%d", i))
+	}
+	three := []Member{testMember("node1"), testMember("node2"), testMember("node3")}
+	four := append(three[:3:3], testMember("node4"))
+
+	tests := []struct {
+		name     string
+		old, new []Member
+		keys     [][]byte
+		min, max float64
+	}{
+		{name: "same members", old: three, new: three, keys: keys, min: 0, max: 0},
+		{name: "add member", old: three, new: four, keys: keys, min: 0.01, max: 0.99},
+		{name: "both empty", keys: keys, min: 0, max: 0},
+		{name: "from empty", new: three, keys: keys, min: 1, max: 1},
+		{name: "to empty", old: three, keys: keys, min: 1, max: 1},
+		{name: "from empty slice", old: []Member{}, new: three, keys: keys, min: 1, max: 1},
+		{name: "to empty slice", old: three, new: []Member{}, keys: keys, min: 1, max: 1},
+		{name: "both empty slices", old: []Member{}, new: []Member{}, keys: keys, min: 0, max: 0},
+		{name: "no keys", old: three, new: four, min: 0, max: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := c.KeysMovedBetween(tt.old, tt.new, tt.keys)
+			if got < tt.min || got > tt.max {
+				t.Errorf("KeysMovedBetween() = %v, want in [%v, %v]", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestConsistentSimulateSetPartitionCount(t *testing.T) {
+	if got, err := New(nil, newConfig()).SimulateSetPartitionCount(71); got != 0 || err != nil {
+		t.Errorf("SimulateSetPartitionCount() on empty ring = %v, %v, want 0", got, err)
+	}
+
+	members := []Member{testMember("node1"), testMember("node2"), testMember("node3"), testMember("node4")}
+	c := New(members, newConfig())
+	before := c.ExportRoutingTable()
+	if got, err := c.SimulateSetPartitionCount(23); got != 0 || err != nil {
+		t.Errorf("SimulateSetPartitionCount() with the current count = %v, %v, want 0", got, err)
+	}
+	for _, n := range []int{0, -1} {
+		if _, err := c.SimulateSetPartitionCount(n); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("SimulateSetPartitionCount(%d) returned %v, want ErrInvalidConfig", n, err)
+		}
+	}
+	var de *DistributionError
+	if _, err := c.SimulateSetPartitionCount(3); !errors.As(err, &de) {
+		t.Errorf("SimulateSetPartitionCount(3) with 4 members returned %v, want a *DistributionError", err)
+	}
+	got, err := c.SimulateSetPartitionCount(71)
+	if err != nil {
+		t.Fatalf("SimulateSetPartitionCount(71) returned %v", err)
+	}
+	// With 4 members, a random new owner keeps about a quarter of the keys.
+	if got < 0.3 || got > 0.95 {
+		t.Errorf("SimulateSetPartitionCount(71) = %v, want a substantial fraction", got)
+	}
+	if after := c.ExportRoutingTable(); !reflect.DeepEqual(after, before) {
+		t.Errorf("SimulateSetPartitionCount() changed the ring")
+	}
+
+	// The estimate matches rebuilding the ring and routing real keys.
+	cfg := newConfig()
+	cfg.PartitionCount = 71
+	rebuilt := New(members, cfg)
+	var moved int
+	for i := 0; i < 20000; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		if c.LocateKey(key).String() != rebuilt.LocateKey(key).String() {
+			moved++
+		}
+	}
+	if actual := float64(moved) / 20000; math.Abs(actual-got) > 0.05 {
+		t.Errorf("SimulateSetPartitionCount(71) = %v, but %v of real keys moved", got, actual)
+	}
+}
+
+// BenchmarkRemove10kMembers measures removing one member's ring points from a
+// 10k-member ring, excluding the redistribution that Remove does afterwards.
+func BenchmarkRemove10kMembers(b *testing.B) {
+	members := make([]Member, 10000)
+	for i := range members {
+		members[i] = testMember(fmt.Sprintf("node%d", i))
+	}
+	cfg := newConfig()
+	cfg.PartitionCount = 20011
+	cfg.HashFunc = mixedHashFunc{}
+	c := New(members, cfg)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		member := members[i%len(members)]
+		c.remove(member.String())
+
+		b.StopTimer()
+		c.add(member)
+		c.sortSet()
+		b.StartTimer()
+	}
+}
+
+// BenchmarkRemoveWhere10kMembers measures removing half of a 10k-member ring
+// with RemoveWhere, redistribution included.
+func BenchmarkRemoveWhere10kMembers(b *testing.B) {
+	members := make([]Member, 10000)
+	for i := range members {
+		members[i] = testMember(fmt.Sprintf("node%d", i))
+	}
+	cfg := newConfig()
+	cfg.PartitionCount = 20011
+	cfg.HashFunc = mixedHashFunc{}
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		c := New(members, cfg)
+		b.StartTimer()
+		c.RemoveWhere(func(name string) bool { return name[len(name)-1]%2 == 0 })
+	}
+}
@@ -0,0 +1,69 @@
+package consistent
+
+import "time"
+
+// Snapshot is an immutable view of the partition table at one point in time.
+// It shares the table with the ring rather than copying it: the ring never
+// modifies a table in place, it builds a new one on every rebalance.
+type Snapshot struct {
+	c          *Consistent
+	partitions map[int]*Member
+	members    int
+	taken      time.Time
+}
+
+// Time returns when the snapshot was taken.
+func (s *Snapshot) Time() time.Time {
+	return s.taken
+}
+
+// MemberCount returns the number of members on the ring when the snapshot was
+// taken.
+func (s *Snapshot) MemberCount() int {
+	return s.members
+}
+
+// LocateKey returns the owner of key's partition in the snapshot, or nil if
+// the ring was empty. Pins are not part of snapshots.
+func (s *Snapshot) LocateKey(key []byte) Member {
+	member, ok := s.partitions[s.c.FindPartitionID(key)]
+	if !ok {
+		return nil
+	}
+	return *member
+}
+
+// recordHistory appends the current partition table to the history, dropping
+// the oldest snapshot once Config.HistorySize are retained.
+func (c *Consistent) recordHistory() {
+	if c.config.HistorySize <= 0 {
+		return
+	}
+	s := &Snapshot{c: c, partitions: c.partitions, members: len(c.members), taken: c.now()}
+	if len(c.history) == c.config.HistorySize {
+		copy(c.history, c.history[1:])
+		c.history = c.history[:len(c.history)-1]
+	}
+	c.history = append(c.history, s)
+}
+
+// History returns the retained snapshots, oldest first. It is empty unless
+// Config.HistorySize is positive.
+func (c *Consistent) History() []*Snapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return append([]*Snapshot(nil), c.history...)
+}
+
+// LocateKeyAt is like LocateKey on the snapshot at index i of History, where
+// 0 is the oldest retained one. It returns nil if i is out of range.
+func (c *Consistent) LocateKeyAt(i int, key []byte) Member {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if i < 0 || i >= len(c.history) {
+		return nil
+	}
+	return c.history[i].LocateKey(key)
+}
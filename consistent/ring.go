@@ -0,0 +1,212 @@
+package consistent
+
+import "sort"
+
+// RingImpl selects the data structure holding the sorted ring points.
+type RingImpl int
+
+const (
+	// SliceRing keeps the points in a sorted slice. Lookups are fast and
+	// compact, but every Add or Remove costs time linear in the ring size. It
+	// is the default.
+	SliceRing RingImpl = iota
+	// TreeRing keeps the points in a balanced tree (a treap), making Add and
+	// Remove O(RF * log n) at the cost of slower lookups. It suits rings with
+	// very frequent membership changes.
+	TreeRing
+)
+
+// ringIndex is the ordered multiset of ring point hashes.
+type ringIndex interface {
+	Len() int
+	// At returns the i-th smallest hash.
+	At(i int) uint64
+	// Search returns the index of the first hash >= h, or Len() if there is
+	// none.
+	Search(h uint64) int
+	// Append adds a hash. The index is only ordered again after Sort.
+	Append(h uint64)
+	Sort()
+	// Delete removes every occurrence of the given hashes.
+	Delete(vals []uint64)
+}
+
+func newRingIndex(impl RingImpl, capacity int) ringIndex {
+	if impl == TreeRing {
+		return &treeRing{}
+	}
+	s := make(sliceRing, 0, capacity)
+	return &s
+}
+
+type sliceRing []uint64
+
+func (s *sliceRing) Len() int {
+	return len(*s)
+}
+
+func (s *sliceRing) At(i int) uint64 {
+	return (*s)[i]
+}
+
+func (s *sliceRing) Search(h uint64) int {
+	return sort.Search(len(*s), func(i int) bool {
+		return (*s)[i] >= h
+	})
+}
+
+func (s *sliceRing) Append(h uint64) {
+	*s = append(*s, h)
+}
+
+func (s *sliceRing) Sort() {
+	sort.Slice(*s, func(i int, j int) bool {
+		return (*s)[i] < (*s)[j]
+	})
+}
+
+// Delete works in a single pass: each hash is located by binary search and
+// the ranges between them are moved down in place. If the set shrank to less
+// than half of its backing array, it is copied into a smaller one so that
+// heavy churn does not pin memory.
+func (s *sliceRing) Delete(vals []uint64) {
+	sort.Slice(vals, func(i, j int) bool {
+		return vals[i] < vals[j]
+	})
+
+	set := *s
+	kept := set[:0]
+	prev := 0
+	for _, val := range vals {
+		// Only search the part not yet overwritten by the compaction.
+		i := prev + sort.Search(len(set)-prev, func(i int) bool {
+			return set[prev+i] >= val
+		})
+		j := i
+		for j < len(set) && set[j] == val {
+			j++
+		}
+		kept = append(kept, set[prev:i]...)
+		prev = j
+	}
+	kept = append(kept, set[prev:]...)
+
+	if len(kept) < cap(kept)/2 {
+		kept = append(make([]uint64, 0, len(kept)), kept...)
+	}
+	*s = kept
+}
+
+// treeRing is a treap ordered by hash, with subtree sizes for indexing.
+type treeRing struct {
+	root *treeNode
+	seed uint64
+}
+
+type treeNode struct {
+	h           uint64
+	prio        uint64
+	size        int
+	left, right *treeNode
+}
+
+func (t *treeRing) Len() int {
+	return t.root.len()
+}
+
+func (t *treeRing) At(i int) uint64 {
+	n := t.root
+	for {
+		if l := n.left.len(); i < l {
+			n = n.left
+		} else if i == l {
+			return n.h
+		} else {
+			i -= l + 1
+			n = n.right
+		}
+	}
+}
+
+func (t *treeRing) Search(h uint64) int {
+	var idx int
+	for n := t.root; n != nil; {
+		if n.h >= h {
+			n = n.left
+		} else {
+			idx += n.left.len() + 1
+			n = n.right
+		}
+	}
+	return idx
+}
+
+func (t *treeRing) Append(h uint64) {
+	// splitmix64 over a counter gives the random priorities.
+	t.seed += 0x9e3779b97f4a7c15
+	z := t.seed
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+
+	l, r := split(t.root, h, false)
+	t.root = merge(merge(l, &treeNode{h: h, prio: z, size: 1}), r)
+}
+
+// Sort is a no-op: the tree is always ordered.
+func (t *treeRing) Sort() {}
+
+func (t *treeRing) Delete(vals []uint64) {
+	for _, val := range vals {
+		l, r := split(t.root, val, false)
+		_, r = split(r, val, true)
+		t.root = merge(l, r)
+	}
+}
+
+func (n *treeNode) len() int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func (n *treeNode) update() {
+	n.size = n.left.len() + 1 + n.right.len()
+}
+
+// split divides n into the hashes below h and the rest. With orEqual, hashes
+// equal to h go to the first part.
+func split(n *treeNode, h uint64, orEqual bool) (*treeNode, *treeNode) {
+	if n == nil {
+		return nil, nil
+	}
+	if n.h < h || orEqual && n.h == h {
+		l, r := split(n.right, h, orEqual)
+		n.right = l
+		n.update()
+		return n, r
+	}
+	l, r := split(n.left, h, orEqual)
+	n.left = r
+	n.update()
+	return l, n
+}
+
+// merge joins two treaps where every hash in a precedes every hash in b.
+func merge(a, b *treeNode) *treeNode {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if a.prio > b.prio {
+		a.right = merge(a.right, b)
+		a.update()
+		return a
+	}
+	b.left = merge(a, b.left)
+	b.update()
+	return b
+}
@@ -0,0 +1,134 @@
+package consistent
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func ringValues(r ringIndex) []uint64 {
+	res := make([]uint64, r.Len())
+	for i := range res {
+		res[i] = r.At(i)
+	}
+	return res
+}
+
+func TestRingIndex(t *testing.T) {
+	for _, impl := range []RingImpl{SliceRing, TreeRing} {
+		t.Run(fmt.Sprint(impl), func(t *testing.T) {
+			r := newRingIndex(impl, 0)
+			for _, h := range []uint64{13, 1, 8, 2, math.MaxUint64, 2, 21, 3, 5} {
+				r.Append(h)
+			}
+			r.Sort()
+			if got, want := ringValues(r), []uint64{1, 2, 2, 3, 5, 8, 13, 21, math.MaxUint64}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("ring = %v, want %v", got, want)
+			}
+
+			searches := []struct {
+				h    uint64
+				want int
+			}{{0, 0}, {1, 0}, {2, 1}, {4, 4}, {21, 7}, {22, 8}, {math.MaxUint64, 8}}
+			for _, s := range searches {
+				if got := r.Search(s.h); got != s.want {
+					t.Errorf("Search(%d) = %d, want %d", s.h, got, s.want)
+				}
+			}
+
+			r.Delete([]uint64{21, 2, 1, 4, math.MaxUint64, 8})
+			if got, want := ringValues(r), []uint64{3, 5, 13}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("ring after Delete = %v, want %v", got, want)
+			}
+			if got := r.Search(100); got != 3 {
+				t.Errorf("Search() past the end = %d, want 3", got)
+			}
+		})
+	}
+}
+
+func TestSliceRingDelete(t *testing.T) {
+	s := sliceRing{1, 2, 2, 3, 5, 8, 13, 21}
+	s.Delete([]uint64{21, 2, 1, 4, 8})
+	if want := (sliceRing{3, 5, 13}); !reflect.DeepEqual(s, want) {
+		t.Fatalf("Delete() left %v, want %v", s, want)
+	}
+	if cap(s) >= 8 {
+		t.Errorf("Delete() kept a backing array of %d for %d hashes", cap(s), len(s))
+	}
+}
+
+func TestConsistentTreeRing(t *testing.T) {
+	members := []Member{testMember("node1"), testMember("node2"), weightedMember{"node3", 2}}
+	sliceCfg := newConfig()
+	treeCfg := newConfig()
+	treeCfg.RingImpl = TreeRing
+	slice, tree := New(members, sliceCfg), New(members, treeCfg)
+
+	steps := []func(c *Consistent){
+		func(c *Consistent) {},
+		func(c *Consistent) { c.Add(testMember("node4")) },
+		func(c *Consistent) { c.Remove("node2") },
+		func(c *Consistent) { c.Add(weightedMember{"node5", 3}) },
+		func(c *Consistent) { c.Remove("node1") },
+	}
+	for i, step := range steps {
+		step(slice)
+		step(tree)
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("step %d: Validate() returned %v", i, err)
+		}
+		if !reflect.DeepEqual(tree.RingPoints(), slice.RingPoints()) {
+			t.Fatalf("step %d: tree and slice rings differ", i)
+		}
+		for partID := 0; partID < 23; partID++ {
+			if got, want := tree.GetPartitionOwner(partID), slice.GetPartitionOwner(partID); got.String() != want.String() {
+				t.Fatalf("step %d: partition %d owned by %v, want %v", i, partID, got, want)
+			}
+		}
+	}
+
+	sliceCfg.RingImpl = 2
+	if _, err := NewWithError(members, sliceCfg); err == nil {
+		t.Error("NewWithError() accepted an unknown RingImpl")
+	}
+}
+
+// BenchmarkChurn measures replacing a member of a 10k-member ring, excluding
+// partition redistribution.
+func BenchmarkChurn(b *testing.B) {
+	for _, impl := range []struct {
+		name string
+		impl RingImpl
+	}{{"slice", SliceRing}, {"tree", TreeRing}} {
+		b.Run(impl.name, func(b *testing.B) {
+			members := make([]Member, 10000)
+			for i := range members {
+				members[i] = testMember(fmt.Sprintf("node%d", i))
+			}
+			cfg := newConfig()
+			cfg.HashFunc = mixedHashFunc{}
+			cfg.RingImpl = impl.impl
+			c := &Consistent{
+				config:    cfg,
+				hashFunc:  cfg.HashFunc,
+				members:   make(map[string]*Member),
+				ring:      make(map[uint64]*Member),
+				sortedSet: newRingIndex(cfg.RingImpl, 0),
+			}
+			for _, m := range members {
+				c.add(m)
+			}
+			c.sortSet()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				member := members[i%len(members)]
+				c.remove(member.String())
+				c.add(member)
+				c.sortSet()
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package consistent
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Stats is a point-in-time summary of the ring, suitable for json.Marshal.
+// Members are identified by their String() value.
+type Stats struct {
+	Members           []string           `json:"members"`
+	PartitionCount    int                `json:"partition_count"`
+	ReplicationFactor int                `json:"replication_factor"`
+	Load              float64            `json:"load"`
+	AverageLoad       float64            `json:"average_load"`
+	MinLoad           float64            `json:"min_load"`
+	MaxLoad           float64            `json:"max_load"`
+	Loads             map[string]float64 `json:"loads"`
+}
+
+// Stats returns a snapshot of the ring configuration and load distribution.
+func (c *Consistent) Stats() Stats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	stats := Stats{
+		Members:           make([]string, 0, len(c.members)),
+		PartitionCount:    int(c.partitionCount),
+		ReplicationFactor: c.config.ReplicationFactor,
+		Load:              c.config.Load,
+		AverageLoad:       c.averageLoad(),
+		Loads:             make(map[string]float64, len(c.members)),
+	}
+	for name := range c.members {
+		stats.Members = append(stats.Members, name)
+	}
+	sort.Strings(stats.Members)
+
+	for i, name := range stats.Members {
+		load := c.loads[name]
+		stats.Loads[name] = load
+		if i == 0 || load < stats.MinLoad {
+			stats.MinLoad = load
+		}
+		if load > stats.MaxLoad {
+			stats.MaxLoad = load
+		}
+	}
+	return stats
+}
+
+// LoadDistributionJSON returns LoadDistribution encoded as a JSON object
+// mapping member names to the number of partitions they own.
+func (c *Consistent) LoadDistributionJSON() ([]byte, error) {
+	return json.Marshal(c.LoadDistribution())
+}
+
+// SatisfiesBoundedLoad reports whether every member owns at most its
+// bounded-load cap of partitions, counting owners in the current partition
+// table. A table taken as is by ImportPartitionTable may not; the next Add or
+// Remove rebalances it. If a member is over its cap, the message names the
+// one with the largest excess, ties going to the smallest name. An empty ring
+// satisfies the bound.
+func (c *Consistent) SatisfiesBoundedLoad() (bool, string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	loads := make(map[string]float64, len(c.members))
+	for _, member := range c.partitions {
+		loads[(*member).String()]++
+	}
+	var worst string
+	var worstExcess float64
+	for name, load := range loads {
+		excess := load - c.memberCap(name)
+		if excess > worstExcess || excess > 0 && excess == worstExcess && name < worst {
+			worst, worstExcess = name, excess
+		}
+	}
+	if worst == "" {
+		return true, ""
+	}
+	return false, fmt.Sprintf("%s owns %v partitions, %v over its cap of %v", worst, loads[worst], worstExcess, c.memberCap(worst))
+}
+
+// Headroom returns, per member, how many more partitions it can take before
+// reaching its bounded-load cap. Zero or negative values mark members at or
+// over capacity; draining members always report zero.
+func (c *Consistent) Headroom() map[string]float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	res := make(map[string]float64, len(c.members))
+	for name := range c.members {
+		if c.drained[name] {
+			res[name] = 0
+			continue
+		}
+		res[name] = c.memberCap(name) - c.loads[name]
+	}
+	return res
+}
+
+// LeastLoadedN returns up to n members with the fewest partitions, in
+// ascending order of load with ties broken by name. Draining members are
+// skipped since they take no new partitions. It returns nil if n is not
+// positive.
+func (c *Consistent) LeastLoadedN(n int) []Member {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if n <= 0 {
+		return nil
+	}
+	names := make([]string, 0, len(c.members))
+	for name := range c.members {
+		if !c.drained[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if c.loads[names[i]] != c.loads[names[j]] {
+			return c.loads[names[i]] < c.loads[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if n > len(names) {
+		n = len(names)
+	}
+	res := make([]Member, n)
+	for i, name := range names[:n] {
+		res[i] = *c.members[name]
+	}
+	return res
+}
+
+// HotMember routes every key in a sample with LocateKey and returns the member
+// receiving the most keys together with its count. Unlike LoadDistribution it
+// reflects the skew of real traffic. Ties go to the lexically smallest name.
+// It returns nil and 0 for an empty sample or ring.
+func (c *Consistent) HotMember(keys [][]byte) (Member, int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	counts := make(map[string]int)
+	owners := make(map[string]Member)
+	for _, key := range keys {
+		member := c.locateKey(key)
+		if member == nil {
+			continue
+		}
+		counts[member.String()]++
+		owners[member.String()] = member
+	}
+
+	var hot Member
+	var max int
+	for name, count := range counts {
+		if count > max || (count == max && name < hot.String()) {
+			hot = owners[name]
+			max = count
+		}
+	}
+	return hot, max
+}
+
+// KeysMovedBetween builds a ring over oldMembers and one over newMembers, both
+// with c's configuration, and returns the fraction of sampleKeys whose owner
+// differs between them. c itself is not used or changed. A key with an owner
+// on one side only, because that member set is empty, counts as moved. It
+// returns 0 for an empty sample.
+func (c *Consistent) KeysMovedBetween(oldMembers, newMembers []Member, sampleKeys [][]byte) float64 {
+	if len(sampleKeys) == 0 {
+		return 0
+	}
+	cfg := c.Configuration()
+	cfg.PrecomputeReplicas = 0
+	cfg.Rand = nil
+	before, after := New(oldMembers, cfg), New(newMembers, cfg)
+
+	var moved int
+	for _, key := range sampleKeys {
+		oldOwner, newOwner := before.LocateKey(key), after.LocateKey(key)
+		if (oldOwner == nil) != (newOwner == nil) || oldOwner != nil && oldOwner.String() != newOwner.String() {
+			moved++
+		}
+	}
+	return float64(moved) / float64(len(sampleKeys))
+}
+
+// simulatedKeys is the number of key hashes SimulateSetPartitionCount
+// samples.
+const simulatedKeys = 1 << 16
+
+// SimulateSetPartitionCount returns the fraction of keys that would change
+// owner if the ring were rebuilt with n partitions and the same members,
+// drained state and configuration otherwise. It samples simulatedKeys
+// uniformly spread key hashes; c is not changed. Pins are ignored. It returns
+// 0 for an empty ring, an error wrapping ErrInvalidConfig if n is not
+// positive, and the *DistributionError New would panic with if the members
+// cannot hold n partitions within their load caps.
+func (c *Consistent) SimulateSetPartitionCount(n int) (float64, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if n <= 0 {
+		return 0, fmt.Errorf("%w: partition count %d must be positive", ErrInvalidConfig, n)
+	}
+	if len(c.members) == 0 {
+		return 0, nil
+	}
+	cfg := c.config
+	cfg.PartitionCount = n
+	cfg.PrecomputeReplicas = 0
+	cfg.HistorySize = 0
+	cfg.Rand = nil
+	sim, err := NewWithError(nil, cfg)
+	if err != nil {
+		return 0, err
+	}
+	for name, member := range c.members {
+		sim.add(*member)
+		if c.drained[name] {
+			sim.drained[name] = true
+		}
+	}
+	sim.sortSet()
+	if err := sim.tryDistributePartitions(); err != nil {
+		return 0, err
+	}
+
+	var moved int
+	var h uint64
+	for i := 0; i < simulatedKeys; i++ {
+		// A splitmix64 sequence stands in for the hashes of real keys.
+		h += 0x9e3779b97f4a7c15
+		z := (h ^ (h >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		z ^= z >> 31
+		before := c.partitions[c.FindPartitionIDForHash(z)]
+		after := sim.partitions[sim.FindPartitionIDForHash(z)]
+		if (*before).String() != (*after).String() {
+			moved++
+		}
+	}
+	return float64(moved) / simulatedKeys, nil
+}
+
+// RecommendPartitionCount returns a partition count for memberCount members
+// such that, with Config.Load set to 1+maxImbalance/2, no member owns more
+// than (1+maxImbalance) times the average number of partitions.
+//
+// The bounded-load cap is ceil(avg * Load), so the worst case ratio is
+// Load + 1/avg; keeping 1/avg <= maxImbalance/2 requires at least 2/maxImbalance
+// partitions per member, plus one so the caps always cover every partition.
+// The result is rounded up to a prime, like DefaultPartitionCount. It returns
+// 0, which New treats as the default, if memberCount or maxImbalance is not
+// positive.
+func RecommendPartitionCount(memberCount int, maxImbalance float64) int {
+	if memberCount <= 0 || maxImbalance <= 0 {
+		return 0
+	}
+	perMember := int(math.Ceil(2/maxImbalance)) + 1
+	n := memberCount * perMember
+	for !isPrime(n) {
+		n++
+	}
+	return n
+}
+
+func isPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for i := 2; i*i <= n; i++ {
+		if n%i == 0 {
+			return false
+		}
+	}
+	return true
+}
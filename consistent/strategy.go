@@ -0,0 +1,152 @@
+package consistent
+
+import (
+	"encoding/binary"
+	"math/rand"
+)
+
+// DistributionStrategy decides which member owns each partition. When the
+// partition table is rebuilt, Assign is called once per partition in
+// ascending partition ID order; idx is the index of the first ring point
+// clockwise from the partition's hash. The returned member's load is
+// incremented before the next call.
+type DistributionStrategy interface {
+	Assign(partID, idx int, ring *RingView) Member
+}
+
+// RingView is the read-only view of the ring given to a DistributionStrategy
+// while the partition table is being rebuilt.
+type RingView struct {
+	c     *Consistent
+	loads map[string]float64
+}
+
+// Len returns the number of ring points.
+func (r *RingView) Len() int {
+	return r.c.sortedSet.Len()
+}
+
+// Point returns the hash of the i-th ring point in ascending order.
+func (r *RingView) Point(i int) uint64 {
+	return r.c.sortedSet.At(i)
+}
+
+// Owner returns the member owning the i-th ring point.
+func (r *RingView) Owner(i int) Member {
+	return *r.c.ring[r.c.sortedSet.At(i)]
+}
+
+// Search returns the index of the first ring point clockwise from h.
+func (r *RingView) Search(h uint64) int {
+	idx := r.c.sortedSet.Search(h)
+	if idx >= r.c.sortedSet.Len() {
+		idx = 0
+	}
+	return idx
+}
+
+// Hash hashes data with the configured HashFunc.
+func (r *RingView) Hash(data []byte) uint64 {
+	return r.c.hashFunc.Sum64(data)
+}
+
+// Load returns the number of partitions assigned to a member so far.
+func (r *RingView) Load(name string) float64 {
+	return r.loads[name]
+}
+
+// Cap returns the bounded-load cap of a member. Draining members report their
+// current load, i.e. they are always at cap.
+func (r *RingView) Cap(name string) float64 {
+	if r.c.drained[name] {
+		return r.loads[name]
+	}
+	return r.c.memberCap(name)
+}
+
+// Draining reports whether a member is draining, i.e. must not be assigned
+// partitions it does not own yet.
+func (r *RingView) Draining(name string) bool {
+	return r.c.drained[name]
+}
+
+// Rand returns Config.Rand, or nil if it is not set.
+func (r *RingView) Rand() *rand.Rand {
+	return r.c.config.Rand
+}
+
+func (r *RingView) distributionError() *DistributionError {
+	return &DistributionError{
+		Members:    len(r.c.members),
+		Partitions: int(r.c.partitionCount),
+		Load:       r.c.config.Load,
+		Cap:        r.c.averageLoad(),
+	}
+}
+
+// BoundedLoad is the default DistributionStrategy: a partition goes to the
+// first member clockwise from its hash that is below its load cap.
+type BoundedLoad struct{}
+
+func (BoundedLoad) Assign(partID, idx int, ring *RingView) Member {
+	var count int
+	for {
+		count++
+		if count >= ring.Len() {
+			panic(ring.distributionError())
+		}
+		member := ring.Owner(idx)
+		if ring.Load(member.String())+1 <= ring.Cap(member.String()) {
+			return member
+		}
+		idx++
+		if idx >= ring.Len() {
+			idx = 0
+		}
+	}
+}
+
+// Unbounded is classic consistent hashing: a partition goes to the first
+// member clockwise from its hash, with no load cap. Draining members are
+// skipped unless every member is draining.
+type Unbounded struct{}
+
+func (Unbounded) Assign(partID, idx int, ring *RingView) Member {
+	for i := 0; i < ring.Len(); i++ {
+		member := ring.Owner((idx + i) % ring.Len())
+		if !ring.Draining(member.String()) {
+			return member
+		}
+	}
+	return ring.Owner(idx)
+}
+
+// TwoChoices applies the power of two choices: each partition is hashed a
+// second way, and of the two members found clockwise from the two hashes the
+// one with the lower current load wins. A tie goes to the first, or to a
+// random one of the two if Config.Rand is set. Members at their load cap are
+// not chosen; if both candidates are full it falls back to BoundedLoad.
+type TwoChoices struct{}
+
+func (TwoChoices) Assign(partID, idx int, ring *RingView) Member {
+	bs := make([]byte, 9)
+	binary.LittleEndian.PutUint64(bs, uint64(partID))
+	bs[8] = 1
+	first, second := ring.Owner(idx), ring.Owner(ring.Search(ring.Hash(bs)))
+
+	firstOK := ring.Load(first.String())+1 <= ring.Cap(first.String())
+	secondOK := ring.Load(second.String())+1 <= ring.Cap(second.String())
+	switch {
+	case firstOK && secondOK:
+		firstLoad, secondLoad := ring.Load(first.String()), ring.Load(second.String())
+		if secondLoad < firstLoad || secondLoad == firstLoad && ring.Rand() != nil && ring.Rand().Intn(2) == 1 {
+			return second
+		}
+		return first
+	case firstOK:
+		return first
+	case secondOK:
+		return second
+	}
+	return BoundedLoad{}.Assign(partID, idx, ring)
+}
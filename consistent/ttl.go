@@ -0,0 +1,57 @@
+package consistent
+
+import "time"
+
+// AddWithTTL adds member like Add and schedules it to expire ttl after
+// Config.Now unless it is refreshed. If the member already exists only its TTL is
+// updated. Expiry is not automatic: no goroutine is started, and expired
+// members are removed by the next call to Tick.
+func (c *Consistent) AddWithTTL(member Member, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	name := member.String()
+	if _, ok := c.members[name]; !ok {
+		c.add(member)
+		c.sortSet()
+		c.distributePartitions()
+	}
+	c.ttls[name] = ttl
+	c.expiry[name] = c.now().Add(ttl)
+}
+
+// Refresh resets the expiry of a member added with AddWithTTL to its TTL
+// after Config.Now. It returns ErrMemberNotFound if there is no such member, for example
+// because it has already expired. Refreshing a member without a TTL is a
+// no-op.
+func (c *Consistent) Refresh(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.members[name]; !ok {
+		return ErrMemberNotFound
+	}
+	if ttl, ok := c.ttls[name]; ok {
+		c.expiry[name] = c.now().Add(ttl)
+	}
+	return nil
+}
+
+// Tick removes every member whose TTL lapsed at or before now, redistributing
+// partitions once, and returns the number of members removed.
+func (c *Consistent) Tick(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var names []string
+	for name, expiry := range c.expiry {
+		if !now.Before(expiry) {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		c.remove(names...)
+		c.redistribute()
+	}
+	return len(names)
+}
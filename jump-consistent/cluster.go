@@ -0,0 +1,174 @@
+package jump
+
+import "sync"
+
+// Cluster maps string keys to a dynamic set of named nodes using jump hash.
+//
+// Each node owns one bucket. Removing a node marks its bucket dead instead of
+// renumbering the others; keys that land on a dead bucket are re-probed with
+// independently mixed keys until they reach a live one, so only the removed
+// node's keys move, and they spread evenly over the remaining nodes. Add revives the lowest dead bucket if there is one and otherwise
+// grows the bucket space by one.
+//
+// Cluster is safe for concurrent use.
+type Cluster struct {
+	mu      sync.Mutex
+	buckets []string       // bucket -> node, "" for a dead bucket
+	index   map[string]int // node -> bucket
+	h       KeyHashFunc
+}
+
+// NewCluster creates a Cluster over nodes, assigning buckets in order.
+func NewCluster(nodes []string, h KeyHashFunc) *Cluster {
+	c := &Cluster{
+		index: make(map[string]int, len(nodes)),
+		h:     h,
+	}
+	for _, node := range nodes {
+		c.add(node)
+	}
+	return c
+}
+
+// Add adds node to the cluster. Adding a node that is already present is a
+// no-op.
+func (c *Cluster) Add(node string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.add(node)
+}
+
+func (c *Cluster) add(node string) {
+	if _, ok := c.index[node]; ok {
+		return
+	}
+	for b, owner := range c.buckets {
+		if owner == "" {
+			c.buckets[b] = node
+			c.index[node] = b
+			return
+		}
+	}
+	c.index[node] = len(c.buckets)
+	c.buckets = append(c.buckets, node)
+}
+
+// Remove removes node from the cluster, marking its bucket dead. Removing a
+// node that is not present is a no-op.
+func (c *Cluster) Remove(node string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.index[node]
+	if !ok {
+		return
+	}
+	c.buckets[b] = ""
+	delete(c.index, node)
+}
+
+// Get returns the node responsible for key, or "" if the cluster is empty.
+func (c *Cluster) Get(key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.index) == 0 {
+		return ""
+	}
+	c.h.Reset()
+	_, err := writeString(c.h, key)
+	if err != nil {
+		panic(err)
+	}
+	return c.buckets[liveBucket(c.h.Sum64(), c.buckets)]
+}
+
+// ShardsPerNode is the number of shard IDs GetWithShard spreads each node's
+// keys over.
+const ShardsPerNode = 256
+
+// GetWithShard is like Get but also returns a shard ID for key: its node's
+// bucket times ShardsPerNode plus the top 8 bits of the key hash multiplied by
+// 0x9e3779b97f4a7c15, which mixes the low bits in for hashers such as FNV
+// whose high bits vary little between similar keys. Buckets do not change
+// while a node is in the cluster, so a key that stays on its node across Add
+// and Remove keeps its shard ID. It returns "", 0 if the cluster is empty.
+func (c *Cluster) GetWithShard(key string) (node string, shardID uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.index) == 0 {
+		return "", 0
+	}
+	c.h.Reset()
+	_, err := writeString(c.h, key)
+	if err != nil {
+		panic(err)
+	}
+	h := c.h.Sum64()
+	b := liveBucket(h, c.buckets)
+	return c.buckets[b], uint64(b)*ShardsPerNode + (h*0x9e3779b97f4a7c15)>>56
+}
+
+// Clone returns a copy of c's current state that hashes keys with h, which
+// must hash like c's hasher. Later changes to c do not affect the copy, so a
+// clone taken before a change can be compared with Remapped.
+func (c *Cluster) Clone(h KeyHashFunc) *Cluster {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clone := &Cluster{
+		buckets: append([]string(nil), c.buckets...),
+		index:   make(map[string]int, len(c.index)),
+		h:       h,
+	}
+	for node, b := range c.index {
+		clone.index[node] = b
+	}
+	return clone
+}
+
+// Remapped returns, for every key that changes owner between the before and
+// after states, its bucket in each state. A key also moves when its bucket is
+// kept but has been taken over by another node. Keys are hashed with
+// before's hasher, so both clusters must hash alike. If either cluster is
+// empty, the result is empty.
+func Remapped(keys []string, before, after *Cluster) map[string][2]int {
+	after.mu.Lock()
+	afterBuckets := append([]string(nil), after.buckets...)
+	afterEmpty := len(after.index) == 0
+	after.mu.Unlock()
+
+	before.mu.Lock()
+	defer before.mu.Unlock()
+
+	res := make(map[string][2]int)
+	if afterEmpty || len(before.index) == 0 {
+		return res
+	}
+	for _, key := range keys {
+		before.h.Reset()
+		_, err := writeString(before.h, key)
+		if err != nil {
+			panic(err)
+		}
+		h := before.h.Sum64()
+		oldB, newB := liveBucket(h, before.buckets), liveBucket(h, afterBuckets)
+		if oldB != newB || before.buckets[oldB] != afterBuckets[newB] {
+			res[key] = [2]int{oldB, newB}
+		}
+	}
+	return res
+}
+
+// liveBucket returns the bucket for a key hash, re-probing with reprobe keys
+// while it lands on a dead ("") bucket. At least one bucket must be live.
+func liveBucket(key uint64, buckets []string) int {
+	n := int32(len(buckets))
+	b := Hash(key, n)
+	for attempt := uint64(1); buckets[b] == ""; attempt++ {
+		b = Hash(reprobe(key, attempt), n)
+	}
+	return int(b)
+}
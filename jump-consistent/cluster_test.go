@@ -0,0 +1,180 @@
+package jump
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func clusterKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+	return keys
+}
+
+func clusterPlacement(c *Cluster, keys []string) map[string]string {
+	res := make(map[string]string, len(keys))
+	for _, key := range keys {
+		res[key] = c.Get(key)
+	}
+	return res
+}
+
+func TestClusterEmpty(t *testing.T) {
+	c := NewCluster(nil, NewFNV1a())
+	if got := c.Get("key"); got != "" {
+		t.Errorf("Get() on empty cluster = %q, want empty", got)
+	}
+	c.Add("a")
+	c.Remove("a")
+	if got := c.Get("key"); got != "" {
+		t.Errorf("Get() after removing every node = %q, want empty", got)
+	}
+}
+
+func TestClusterRemove(t *testing.T) {
+	keys := clusterKeys(10000)
+	c := NewCluster([]string{"a", "b", "c", "d", "e"}, NewFNV1a())
+	before := clusterPlacement(c, keys)
+
+	c.Remove("c")
+	after := clusterPlacement(c, keys)
+	for _, key := range keys {
+		if after[key] == "c" {
+			t.Fatalf("key %s still routed to removed node", key)
+		}
+		if before[key] != "c" && before[key] != after[key] {
+			t.Fatalf("key %s moved from %s to %s although its node stayed", key, before[key], after[key])
+		}
+	}
+
+	// Re-adding revives the dead bucket and restores the original placement.
+	c.Add("c")
+	for key, node := range clusterPlacement(c, keys) {
+		if node != before[key] {
+			t.Fatalf("key %s routed to %s after re-adding, want %s", key, node, before[key])
+		}
+	}
+}
+
+func TestClusterRemoveBalance(t *testing.T) {
+	nodes := make([]string, 10)
+	for i := range nodes {
+		nodes[i] = "n" + strconv.Itoa(i)
+	}
+	c := NewCluster(nodes, NewXXHash())
+	c.Remove("n2")
+
+	keys := clusterKeys(200000)
+	counts := make(map[string]int)
+	for _, node := range clusterPlacement(c, keys) {
+		counts[node]++
+	}
+	want := float64(len(keys)) / 9
+	for _, node := range nodes {
+		if node == "n2" {
+			continue
+		}
+		if math.Abs(float64(counts[node])-want) > 0.03*want {
+			t.Errorf("node %s got %d keys after removing n2, want about %v", node, counts[node], want)
+		}
+	}
+}
+
+func TestClusterAdd(t *testing.T) {
+	keys := clusterKeys(10000)
+	c := NewCluster([]string{"a", "b", "c", "d"}, NewFNV1a())
+	before := clusterPlacement(c, keys)
+
+	c.Add("e")
+	var moved int
+	for key, node := range clusterPlacement(c, keys) {
+		if node == before[key] {
+			continue
+		}
+		if node != "e" {
+			t.Fatalf("key %s moved from %s to %s instead of the new node", key, before[key], node)
+		}
+		moved++
+	}
+	if ratio := float64(moved) / float64(len(keys)); ratio < 0.15 || ratio > 0.25 {
+		t.Errorf("expected about 1/5 of keys to move, got %v", ratio)
+	}
+}
+
+func TestClusterGetWithShard(t *testing.T) {
+	if node, shard := NewCluster(nil, NewFNV1a()).GetWithShard("key"); node != "" || shard != 0 {
+		t.Errorf("GetWithShard() on empty cluster = %q, %d", node, shard)
+	}
+
+	keys := clusterKeys(10000)
+	c := NewCluster([]string{"a", "b", "c", "d"}, NewFNV1a())
+	type placement struct {
+		node  string
+		shard uint64
+	}
+	before := make(map[string]placement, len(keys))
+	shards := make(map[uint64]string)
+	for _, key := range keys {
+		node, shard := c.GetWithShard(key)
+		if node != c.Get(key) {
+			t.Fatalf("GetWithShard(%s) node = %s, want %s", key, node, c.Get(key))
+		}
+		if owner, ok := shards[shard]; ok && owner != node {
+			t.Fatalf("shard %d holds keys of %s and %s", shard, owner, node)
+		}
+		shards[shard] = node
+		before[key] = placement{node, shard}
+	}
+	if len(shards) < 4*ShardsPerNode*9/10 {
+		t.Errorf("keys spread over %d shards, want about %d", len(shards), 4*ShardsPerNode)
+	}
+
+	c.Add("e")
+	c.Remove("b")
+	for _, key := range keys {
+		node, shard := c.GetWithShard(key)
+		if node == before[key].node && shard != before[key].shard {
+			t.Fatalf("key %s stayed on %s but shard changed from %d to %d", key, node, before[key].shard, shard)
+		}
+	}
+}
+
+func TestRemapped(t *testing.T) {
+	keys := clusterKeys(10000)
+	c := NewCluster([]string{"a", "b", "c", "d", "e"}, NewFNV1a())
+	before := c.Clone(NewFNV1a())
+	beforePlacement := clusterPlacement(c, keys)
+
+	// "f" takes over the bucket freed by "c", then "g" grows the bucket space.
+	c.Remove("c")
+	c.Add("f")
+	c.Add("g")
+	afterPlacement := clusterPlacement(c, keys)
+
+	moved := Remapped(keys, before, c)
+	for _, key := range keys {
+		b, ok := moved[key]
+		if changed := beforePlacement[key] != afterPlacement[key]; ok != changed {
+			t.Fatalf("key %s listed = %v, want %v (%s -> %s)", key, ok, changed, beforePlacement[key], afterPlacement[key])
+		}
+		if !ok {
+			continue
+		}
+		if before.buckets[b[0]] != beforePlacement[key] || c.buckets[b[1]] != afterPlacement[key] {
+			t.Fatalf("key %s remapped %v, want buckets of %s -> %s", key, b, beforePlacement[key], afterPlacement[key])
+		}
+	}
+	if len(moved) == 0 {
+		t.Fatal("Remapped() listed no keys")
+	}
+
+	if got := Remapped(keys, c, c); len(got) != 0 {
+		t.Errorf("Remapped() between identical states listed %d keys", len(got))
+	}
+	if got := Remapped(keys, NewCluster(nil, NewFNV1a()), c); len(got) != 0 {
+		t.Errorf("Remapped() from an empty cluster listed %d keys", len(got))
+	}
+}
@@ -1,17 +1,121 @@
 package jump
 
 import (
+	"encoding/binary"
 	"hash"
 	"hash/crc32"
 	"hash/crc64"
 	"hash/fnv"
 	"io"
+	"reflect"
+	"sync"
+	"unsafe"
 )
 
 // base on https://arxiv.org/pdf/1406.2294v1
 // https://github.com/lithammer/go-jump-consistent-hash
 
 func Hash(key uint64, buckets int32) int32 {
+	// 2^31 as a float64; the loop divides it by the next random value.
+	const scale = float64(int64(1) << 31)
+
+	var b, j int64
+
+	if buckets <= 0 {
+		buckets = 1
+	}
+	n := int64(buckets)
+
+	for j < n {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (scale / float64((key>>33)+1)))
+	}
+
+	return int32(b)
+}
+
+// HashNZoned returns up to n buckets for key, no two of which share a zone as
+// reported by zoneOf. Candidates are Hash(key, buckets), then Hash(reprobe(key,
+// i), buckets) for i = 1, 2, ..., so the first bucket is always Hash(key,
+// buckets), later candidates are independent of it, and the result is
+// deterministic.
+//
+// If no new zone turns up within 64*n candidates, the remaining buckets are
+// scanned in order after the last candidate. When there are fewer than n
+// distinct zones the result therefore holds one bucket per zone, i.e. fewer
+// than n buckets. It returns nil if n <= 0.
+func HashNZoned(key uint64, buckets int32, n int, zoneOf func(bucket int) int) []int32 {
+	if n <= 0 {
+		return nil
+	}
+	if buckets <= 0 {
+		buckets = 1
+	}
+
+	res := make([]int32, 0, n)
+	zones := make(map[int]bool, n)
+	b := Hash(key, buckets)
+	for probes := 0; len(res) < n && probes < 64*n; probes++ {
+		if probes > 0 {
+			b = Hash(reprobe(key, uint64(probes)), buckets)
+		}
+		if zone := zoneOf(int(b)); !zones[zone] {
+			zones[zone] = true
+			res = append(res, b)
+		}
+	}
+	for i := int32(1); len(res) < n && i < buckets; i++ {
+		next := (b + i) % buckets
+		if zone := zoneOf(int(next)); !zones[zone] {
+			zones[zone] = true
+			res = append(res, next)
+		}
+	}
+	return res
+}
+
+// reprobe returns the key for the given attempt (from 1) of a probe sequence
+// starting at key: splitmix64 of key^attempt. Unlike stepping Hash's own LCG,
+// this makes each probe independent of the ones before it.
+func reprobe(key, attempt uint64) uint64 {
+	z := (key ^ attempt) + 0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Integer is the set of key types accepted by HashInt.
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// HashInt is Hash for any integer key type. Unsigned keys are zero-extended to
+// uint64. Signed keys are sign-extended to 64 bits and the resulting bit
+// pattern is used as is, so HashInt(int32(-1), n) == Hash(math.MaxUint64, n)
+// and HashInt(int64(k), n) == Hash(uint64(k), n) for any k.
+func HashInt[T Integer](key T, buckets int32) int32 {
+	return Hash(uint64(key), buckets)
+}
+
+// HashSigned is Hash for a signed key. The key is converted by reinterpreting
+// its two's complement bits as uint64, so -1 hashes like 0xFFFFFFFFFFFFFFFF.
+// This is the conversion C, C++ and Rust perform when casting int64 to
+// uint64, and what Java code gets by shifting the key with >>>.
+func HashSigned(key int64, buckets int32) int32 {
+	return Hash(uint64(key), buckets)
+}
+
+// HashFixedPoint is an integer-only variant of Hash. It replaces the float64
+// division with the exact fixed-point quotient ((b+1) << 31) / ((key>>33)+1).
+//
+// The results are not always identical to Hash: when the exact quotient lies
+// just below an integer, the float64 rounding in Hash can round it up, so the
+// two functions occasionally pick different buckets (about 1 in 10 million
+// random key/bucket pairs). Use it only when every party computing placements
+// uses HashFixedPoint.
+func HashFixedPoint(key uint64, buckets int32) int32 {
 	var b, j int64
 
 	if buckets <= 0 {
@@ -21,21 +125,83 @@ func Hash(key uint64, buckets int32) int32 {
 	for j < int64(buckets) {
 		b = j
 		key = key*2862933555777941757 + 1
-		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+		j = int64((uint64(b+1) << 31) / ((key >> 33) + 1))
 	}
 
 	return int32(b)
 }
 
+// PlacementToken returns a 64-bit token for key that sorts by bucket: the high
+// 32 bits are Hash(key, buckets) and the low 32 bits are the high 32 bits of
+// key. Tokens of keys in the same bucket form one contiguous range, which
+// suits range-partitioned stores. The format is fixed, so tokens can be
+// recomputed anywhere from the key hash and bucket count.
+func PlacementToken(key uint64, buckets int32) uint64 {
+	return uint64(Hash(key, buckets))<<32 | key>>32
+}
+
 func HashString(key string, buckets int32, h KeyHashFunc) int32 {
 	h.Reset()
-	_, err := io.WriteString(h, key)
+	_, err := writeString(h, key)
 	if err != nil {
 		panic(err)
 	}
 	return Hash(h.Sum64(), buckets)
 }
 
+// HashFields hashes a composite key made of fields and returns its bucket,
+// without concatenating the fields first. Each field is written to h preceded
+// by its length as an 8-byte little-endian integer, so ("ab", "c") and
+// ("a", "bc") hash differently. To reproduce the hash elsewhere, feed the
+// hasher len(field) as a uint64 LE followed by the field bytes, for each field
+// in order.
+func HashFields(buckets int32, h KeyHashFunc, fields ...[]byte) int32 {
+	h.Reset()
+	var length [8]byte
+	for _, field := range fields {
+		binary.LittleEndian.PutUint64(length[:], uint64(len(field)))
+		if _, err := h.Write(length[:]); err != nil {
+			panic(err)
+		}
+		if _, err := h.Write(field); err != nil {
+			panic(err)
+		}
+	}
+	return Hash(h.Sum64(), buckets)
+}
+
+// HashStringE is like HashString but returns the error from writing key to h
+// instead of panicking, for KeyHashFunc implementations that can fail.
+func HashStringE(key string, buckets int32, h KeyHashFunc) (int32, error) {
+	h.Reset()
+	_, err := writeString(h, key)
+	if err != nil {
+		return 0, err
+	}
+	return Hash(h.Sum64(), buckets), nil
+}
+
+// builtinHashers holds the types of the package's own hashers, which are
+// known not to modify or retain what they are given to write.
+var builtinHashers = map[reflect.Type]bool{
+	reflect.TypeOf(NewCRC32()):  true,
+	reflect.TypeOf(NewCRC64()):  true,
+	reflect.TypeOf(NewFNV1()):   true,
+	reflect.TypeOf(NewFNV1a()):  true,
+	reflect.TypeOf(NewXXHash()): true,
+}
+
+// writeString writes key to h. The built-in hashers get the string's bytes
+// directly, without a copy. Any other hasher gets io.WriteString, which copies
+// the key unless h is an io.StringWriter, so that a hasher breaking the
+// io.Writer contract by modifying its argument cannot corrupt the string.
+func writeString(h KeyHashFunc, key string) (int, error) {
+	if builtinHashers[reflect.TypeOf(h)] {
+		return h.Write(unsafe.Slice(unsafe.StringData(key), len(key)))
+	}
+	return io.WriteString(h, key)
+}
+
 type KeyHashFunc interface {
 	io.Writer
 
@@ -43,13 +209,51 @@ type KeyHashFunc interface {
 	Sum64() uint64
 }
 
+// HashFunc maps string keys to n buckets with a KeyHashFunc. Every call resets
+// the hasher before writing the key.
+//
+// A HashFunc made by New shares one hasher between all calls and serializes
+// them with a mutex, so it is safe for concurrent use as long as its hasher is
+// not used elsewhere, but concurrent callers contend for that one lock. A
+// HashFunc made by NewPooled instead takes a hasher from a pool for each call,
+// so calls run in parallel.
 type HashFunc struct {
-	n int32
-	h KeyHashFunc
+	mu   sync.Mutex
+	n    int32
+	h    KeyHashFunc
+	pool *sync.Pool // nil for a HashFunc made by New
 }
 
 func New(n int, h KeyHashFunc) *HashFunc {
-	return &HashFunc{int32(n), h}
+	return &HashFunc{n: int32(n), h: h}
+}
+
+// NewPooled returns a HashFunc that draws hashers made by newHash from a
+// pool, e.g. NewPooled(n, NewXXHash), so that concurrent calls do not
+// serialize.
+func NewPooled[H KeyHashFunc](n int, newHash func() H) *HashFunc {
+	return &HashFunc{
+		n:    int32(n),
+		pool: &sync.Pool{New: func() any { return KeyHashFunc(newHash()) }},
+	}
+}
+
+// acquire returns a hasher for the exclusive use of the caller, who must pass
+// it to release when done.
+func (h *HashFunc) acquire() KeyHashFunc {
+	if h.pool != nil {
+		return h.pool.Get().(KeyHashFunc)
+	}
+	h.mu.Lock()
+	return h.h
+}
+
+func (h *HashFunc) release(kh KeyHashFunc) {
+	if h.pool != nil {
+		h.pool.Put(kh)
+		return
+	}
+	h.mu.Unlock()
 }
 
 func (h *HashFunc) N() int {
@@ -57,7 +261,111 @@ func (h *HashFunc) N() int {
 }
 
 func (h *HashFunc) Hash(key string) int {
-	return int(HashString(key, h.n, h.h))
+	kh := h.acquire()
+	defer h.release(kh)
+
+	return int(HashString(key, h.n, kh))
+}
+
+// HashE is like Hash but returns the hasher's write error instead of
+// panicking.
+func (h *HashFunc) HashE(key string) (int, error) {
+	kh := h.acquire()
+	defer h.release(kh)
+
+	b, err := HashStringE(key, h.n, kh)
+	return int(b), err
+}
+
+// HashBytes is like Hash but writes key to the hasher directly, avoiding the
+// string conversion for callers that already hold a []byte.
+func (h *HashFunc) HashBytes(key []byte) int {
+	kh := h.acquire()
+	defer h.release(kh)
+
+	kh.Reset()
+	_, err := kh.Write(key)
+	if err != nil {
+		panic(err)
+	}
+	return int(Hash(kh.Sum64(), h.n))
+}
+
+// fingerprintProbe is the key whose hash identifies the hasher in
+// Fingerprint.
+const fingerprintProbe = "jump-consistent/fingerprint"
+
+// Fingerprint returns a value identifying the bucket count and the hasher, so
+// that nodes can compare fingerprints to check that they route keys alike.
+// The hasher is identified by its hash of a fixed probe key rather than by its
+// type, which also tells apart hashers of one type with different parameters,
+// e.g. CRC-64 with the ECMA and ISO tables. Fingerprints are stable across
+// processes and versions as long as the hasher's output is.
+func (h *HashFunc) Fingerprint() uint64 {
+	kh := h.acquire()
+	defer h.release(kh)
+
+	kh.Reset()
+	_, err := writeString(kh, fingerprintProbe)
+	if err != nil {
+		panic(err)
+	}
+	// Mix with the splitmix64 finalizer so nearby bucket counts differ in
+	// every bit.
+	z := kh.Sum64() ^ uint64(h.n)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// HashAll returns Hash(key) for every key in keys, in order, taking the lock
+// or pooled hasher once for the whole batch.
+func (h *HashFunc) HashAll(keys []string) []int {
+	kh := h.acquire()
+	defer h.release(kh)
+
+	res := make([]int, len(keys))
+	for i, key := range keys {
+		res[i] = int(HashString(key, h.n, kh))
+	}
+	return res
+}
+
+// Distribution hashes every key with h and returns the number of keys per
+// bucket, indexed by bucket.
+func (h *HashFunc) Distribution(keys []string) []int {
+	n := h.n
+	if n <= 0 {
+		n = 1
+	}
+	counts := make([]int, n)
+
+	kh := h.acquire()
+	defer h.release(kh)
+
+	for _, key := range keys {
+		counts[HashString(key, h.n, kh)]++
+	}
+	return counts
+}
+
+// RebalanceReport reports how many of keys would change bucket if the bucket
+// count changed from oldN to newN, and the moved fraction of keys. The keys
+// are hashed with h's hasher; h's own bucket count is not used.
+func (h *HashFunc) RebalanceReport(keys []string, oldN, newN int) (moved int, ratio float64) {
+	if len(keys) == 0 {
+		return 0, 0
+	}
+
+	kh := h.acquire()
+	defer h.release(kh)
+
+	for _, key := range keys {
+		if HashString(key, int32(oldN), kh) != HashString(key, int32(newN), kh) {
+			moved++
+		}
+	}
+	return moved, float64(moved) / float64(len(keys))
 }
 
 var (
@@ -65,9 +373,13 @@ var (
 	NewCRC64 func() hash.Hash64 = func() hash.Hash64 { return crc64.New(crc64.MakeTable(crc64.ECMA)) }
 	NewFNV1  func() hash.Hash64 = func() hash.Hash64 { return fnv.New64() }
 	NewFNV1a func() hash.Hash64 = func() hash.Hash64 { return fnv.New64a() }
+	// NewXXHash returns an xxHash64 (seed 0), which mixes short keys better
+	// than FNV and CRC.
+	NewXXHash func() hash.Hash64 = func() hash.Hash64 { return newXXHash() }
 
-	CRC32 hash.Hash64 = &crc32HashFunc{crc32.NewIEEE()}
-	CRC64 hash.Hash64 = crc64.New(crc64.MakeTable(crc64.ECMA))
-	FNV1  hash.Hash64 = fnv.New64()
-	FNV1a hash.Hash64 = fnv.New64a()
+	CRC32  hash.Hash64 = &crc32HashFunc{crc32.NewIEEE()}
+	CRC64  hash.Hash64 = crc64.New(crc64.MakeTable(crc64.ECMA))
+	FNV1   hash.Hash64 = fnv.New64()
+	FNV1a  hash.Hash64 = fnv.New64a()
+	XXHash hash.Hash64 = newXXHash()
 )
@@ -1,9 +1,15 @@
 package jump
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash"
+	"hash/crc64"
+	"math"
+	"math/rand"
 	"strconv"
+	"sync"
 	"testing"
 )
 
@@ -32,6 +38,291 @@ func TestJumpHash(t *testing.T) {
 	}
 }
 
+// hashReference is the loop exactly as written in the paper.
+func hashReference(key uint64, buckets int32) int32 {
+	var b, j int64
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int32(b)
+}
+
+func TestHashMatchesReference(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		key, buckets := r.Uint64(), r.Int31()+1
+		if h, want := Hash(key, buckets), hashReference(key, buckets); h != want {
+			t.Fatalf("Hash(%d, %d) = %d, want %d", key, buckets, h, want)
+		}
+	}
+}
+
+func TestHashInt(t *testing.T) {
+	for _, v := range jumpTestVectors {
+		if h := HashInt(v.key, v.buckets); h != v.expected {
+			t.Errorf("expected bucket for key=%d to be %d, got %d",
+				v.key, v.expected, h)
+		}
+	}
+
+	if HashInt(uint32(42), 57) != Hash(42, 57) || HashInt(42, 57) != Hash(42, 57) {
+		t.Errorf("HashInt does not widen small unsigned keys to the same uint64")
+	}
+	if HashInt(int8(-1), 666) != Hash(math.MaxUint64, 666) ||
+		HashInt(int32(-1), 666) != Hash(math.MaxUint64, 666) {
+		t.Errorf("HashInt does not sign-extend negative keys")
+	}
+	if HashInt(int64(-42), 666) != Hash(uint64(0xFFFFFFFFFFFFFFD6), 666) {
+		t.Errorf("HashInt does not use the two's complement bit pattern")
+	}
+}
+
+// signedTestVectors were computed with an independent implementation of the
+// reference loop from the paper over the two's complement bits of key.
+var signedTestVectors = []struct {
+	key      int64
+	buckets  int32
+	expected int32
+}{
+	{-1, 1, 0},
+	{-1, 666, 313},
+	{-42, 57, 8},
+	{-42, 1024, 828},
+	{-0xDEAD10CC, 666, 209},
+	{-123456789, 100000, 66210},
+	{math.MinInt64, 1000, 453},
+}
+
+func TestHashSigned(t *testing.T) {
+	for _, v := range signedTestVectors {
+		if h := HashSigned(v.key, v.buckets); h != v.expected {
+			t.Errorf("expected bucket for key=%d to be %d, got %d",
+				v.key, v.expected, h)
+		}
+	}
+	for _, v := range jumpTestVectors {
+		if h := HashSigned(int64(v.key), v.buckets); h != v.expected {
+			t.Errorf("expected bucket for key=%d to be %d, got %d",
+				v.key, v.expected, h)
+		}
+	}
+}
+
+func TestHashNZoned(t *testing.T) {
+	// 12 buckets spread over 4 zones.
+	zoneOf := func(bucket int) int { return bucket % 4 }
+
+	for key := uint64(0); key < 1000; key++ {
+		got := HashNZoned(key, 12, 3, zoneOf)
+		if len(got) != 3 {
+			t.Fatalf("HashNZoned(%d) returned %d buckets, want 3", key, len(got))
+		}
+		if got[0] != Hash(key, 12) {
+			t.Errorf("HashNZoned(%d)[0] = %d, want Hash() = %d", key, got[0], Hash(key, 12))
+		}
+		zones := make(map[int]bool)
+		for _, b := range got {
+			if b < 0 || b >= 12 || zones[zoneOf(int(b))] {
+				t.Fatalf("HashNZoned(%d) = %v repeats a zone or is out of range", key, got)
+			}
+			zones[zoneOf(int(b))] = true
+		}
+	}
+
+	// The second replica's zone is uniform over the zones other than the
+	// first's.
+	var pairs [4][4]int
+	const keyCount = 48000
+	for i := uint64(0); i < keyCount; i++ {
+		got := HashNZoned(i*0x9e3779b97f4a7c15, 12, 2, zoneOf)
+		pairs[zoneOf(int(got[0]))][zoneOf(int(got[1]))]++
+	}
+	for z0 := range pairs {
+		for z1, count := range pairs[z0] {
+			if z0 == z1 {
+				continue
+			}
+			if want := float64(keyCount) / 12; math.Abs(float64(count)-want) > 0.05*want {
+				t.Errorf("zones %d then %d picked for %d keys, want about %v", z0, z1, count, want)
+			}
+		}
+	}
+
+	// Only 4 zones exist, so asking for 6 replicas yields 4.
+	if got := HashNZoned(42, 12, 6, zoneOf); len(got) != 4 {
+		t.Errorf("HashNZoned() with too few zones = %v, want 4 buckets", got)
+	}
+	if got := HashNZoned(42, 12, 0, zoneOf); got != nil {
+		t.Errorf("HashNZoned() with n=0 = %v, want nil", got)
+	}
+}
+
+func TestHashFixedPoint(t *testing.T) {
+	for _, v := range jumpTestVectors {
+		h := HashFixedPoint(v.key, v.buckets)
+		if h != v.expected {
+			t.Errorf("expected bucket for key=%d to be %d, got %d",
+				v.key, v.expected, h)
+		}
+	}
+}
+
+// Known pairs where the float64 rounding in Hash differs from the exact
+// fixed-point quotient used by HashFixedPoint.
+var jumpFixedPointDivergence = []struct {
+	key     uint64
+	buckets int32
+	float   int32
+	fixed   int32
+}{
+	{1060917919583576631, 587390487, 473684122, 473684135},
+	{15025513838832047397, 1767084784, 967017039, 967017038},
+}
+
+func TestHashFixedPointDivergence(t *testing.T) {
+	for _, v := range jumpFixedPointDivergence {
+		if h := Hash(v.key, v.buckets); h != v.float {
+			t.Errorf("Hash(%d, %d) = %d, want %d", v.key, v.buckets, h, v.float)
+		}
+		if h := HashFixedPoint(v.key, v.buckets); h != v.fixed {
+			t.Errorf("HashFixedPoint(%d, %d) = %d, want %d", v.key, v.buckets, h, v.fixed)
+		}
+	}
+}
+
+func BenchmarkHash(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Hash(uint64(i), 1024)
+	}
+}
+
+func BenchmarkHashLargeBuckets(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Hash(uint64(i), 1<<30)
+	}
+}
+
+func BenchmarkHashFixedPoint(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		HashFixedPoint(uint64(i), 1024)
+	}
+}
+
+// Routing a string or []byte key through a built-in hasher does not allocate:
+// 0 allocs/op for each of the benchmarks below.
+
+func BenchmarkHashString(b *testing.B) {
+	h := NewFNV1a()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		HashString("tenant/object/v1", 1024, h)
+	}
+}
+
+func BenchmarkHashFuncHash(b *testing.B) {
+	h := New(1024, NewXXHash())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		h.Hash("tenant/object/v1")
+	}
+}
+
+func BenchmarkHashFuncHashBytes(b *testing.B) {
+	h := New(1024, NewXXHash())
+	key := []byte("tenant/object/v1")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		h.HashBytes(key)
+	}
+}
+
+func BenchmarkHashFuncHashParallel(b *testing.B) {
+	for name, h := range map[string]*HashFunc{
+		"locked": New(1024, NewXXHash()),
+		"pooled": NewPooled(1024, NewXXHash),
+	} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					h.Hash("tenant/object/v1")
+				}
+			})
+		})
+	}
+}
+
+func TestHashStringAllocs(t *testing.T) {
+	for name, h := range map[string]KeyHashFunc{"crc32": NewCRC32(), "fnv1a": NewFNV1a(), "xxhash": NewXXHash()} {
+		if n := testing.AllocsPerRun(100, func() { HashString("tenant/object/v1", 1024, h) }); n != 0 {
+			t.Errorf("%s: HashString() made %v allocations, want 0", name, n)
+		}
+	}
+	key := []byte("tenant/object/v1")
+	for name, hf := range map[string]*HashFunc{"New": New(1024, NewXXHash()), "NewPooled": NewPooled(1024, NewXXHash)} {
+		if n := testing.AllocsPerRun(100, func() { hf.Hash("tenant/object/v1"); hf.HashBytes(key) }); n != 0 {
+			t.Errorf("%s: HashFunc made %v allocations, want 0", name, n)
+		}
+	}
+}
+
+// scribbleHash is a hasher that breaks the io.Writer contract by zeroing its
+// input.
+type scribbleHash struct {
+	hash.Hash64
+}
+
+func (h scribbleHash) Write(p []byte) (int, error) {
+	n, err := h.Hash64.Write(p)
+	for i := range p {
+		p[i] = 0
+	}
+	return n, err
+}
+
+func TestHashStringCustomHasher(t *testing.T) {
+	key := "tenant/object/v1"
+	want := HashString(key, 1024, NewFNV1a())
+	if got := HashString(key, 1024, scribbleHash{NewFNV1a()}); got != want {
+		t.Errorf("HashString() with a custom hasher = %d, want %d", got, want)
+	}
+	if key != "tenant/object/v1" {
+		t.Errorf("custom hasher modified the key to %q", key)
+	}
+}
+
+func FuzzHash(f *testing.F) {
+	for _, v := range jumpTestVectors {
+		f.Add(v.key, v.buckets)
+	}
+	f.Add(uint64(math.MaxUint64), int32(math.MaxInt32))
+
+	f.Fuzz(func(t *testing.T, key uint64, buckets int32) {
+		h := Hash(key, buckets)
+		if buckets <= 0 {
+			if h != 0 {
+				t.Fatalf("Hash(%d, %d) = %d, want 0 for non-positive buckets", key, buckets, h)
+			}
+			return
+		}
+		if h < 0 || h >= buckets {
+			t.Fatalf("Hash(%d, %d) = %d, out of range", key, buckets, h)
+		}
+		if again := Hash(key, buckets); again != h {
+			t.Fatalf("Hash(%d, %d) is unstable: %d then %d", key, buckets, h, again)
+		}
+		// Minimal remapping: adding a bucket either keeps the key in place or
+		// moves it to the new bucket.
+		if buckets < math.MaxInt32 {
+			if next := Hash(key, buckets+1); next != h && next != buckets {
+				t.Fatalf("Hash(%d, %d) = %d but Hash(%d, %d) = %d", key, buckets, h, key, buckets+1, next)
+			}
+		}
+	})
+}
+
 var jumpStringTestVectors = []struct {
 	key      string
 	buckets  int32
@@ -43,6 +334,22 @@ var jumpStringTestVectors = []struct {
 	{"ветер", 10, NewFNV1, 3},
 	{"中国", 10, NewFNV1a, 5},
 	{"日本", 10, NewCRC64, 6},
+	{"localhost", 10, NewXXHash, 3},
+}
+
+func TestPlacementToken(t *testing.T) {
+	for _, v := range jumpTestVectors {
+		token := PlacementToken(v.key, v.buckets)
+		if got := int32(token >> 32); got != v.expected {
+			t.Errorf("PlacementToken(%d, %d) bucket = %d, want %d", v.key, v.buckets, got, v.expected)
+		}
+		if got := uint32(token); got != uint32(v.key>>32) {
+			t.Errorf("PlacementToken(%d, %d) offset = %#x, want %#x", v.key, v.buckets, got, v.key>>32)
+		}
+	}
+	if got := PlacementToken(0xdeadbeef00000000, 1); got != 0xdeadbeef {
+		t.Errorf("PlacementToken() with one bucket = %#x, want 0xdeadbeef", got)
+	}
 }
 
 func TestJumpHashString(t *testing.T) {
@@ -55,6 +362,162 @@ func TestJumpHashString(t *testing.T) {
 	}
 }
 
+// referenceTestVectors and referenceStringTestVectors were generated outside
+// Go by a Python port of the loop from the paper and of the five hashers, so
+// Hash and HashString stay compatible with the published algorithm.
+// Note that CRC32 keys are zero-extended, so their top 32 bits are always 0.
+var referenceTestVectors = []struct {
+	key      uint64
+	buckets  int32
+	expected int32
+}{
+	{0x0, 3, 0},
+	{0x0, 10000000, 0},
+	{0x0, 1048576, 0},
+	{0x1, 65536, 21134},
+	{0x1, 1048576, 985611},
+	{0x1, 2, 0},
+	{0x2, 1000, 338},
+	{0x2, 2, 0},
+	{0x2, 1, 0},
+	{0x2a, 65536, 5747},
+	{0xdeadbeef, 65536, 64244},
+	{0xdeadbeef, 1000, 285},
+	{0xdeadbeef, 10000000, 479362},
+	{0xdead10cc, 1048576, 1047510},
+	{0xdead10cc, 1, 0},
+	{0xdead10cc, 100, 94},
+	{0x100000000, 2, 1},
+	{0x100000000, 2147483647, 1378953490},
+	{0x100000000, 1048576, 247146},
+	{0xffffffff, 1, 0},
+	{0xffffffff, 2147483647, 860568},
+	{0xffffffff, 1000, 875},
+	{0x8000000000000000, 65536, 53854},
+	{0x8000000000000000, 1000, 453},
+	{0x8000000000000000, 2147483647, 1119800965},
+	{0xffffffffffffffff, 1048576, 589430},
+	{0xffffffffffffffff, 100, 92},
+	{0xfffffffffffffffe, 10000000, 6787933},
+	{0xfffffffffffffffe, 3, 1},
+	{0xfffffffffffffffe, 10, 3},
+	{0x123456789abcdef, 2, 0},
+	{0x123456789abcdef, 3, 0},
+	{0x2efc6236519f54aa, 18, 5},
+	{0x50e23d16522f836c, 61356, 19413},
+	{0xbce4a00934fe8adf, 18676, 17746},
+	{0x428d124308508725, 19391, 17726},
+	{0x369af6527c5669c0, 41576, 38740},
+	{0xb778e39a189c7c48, 34, 24},
+	{0x9e3a8f6a0bb022c9, 1925481175, 1891476435},
+	{0x6d9f0ee9957355ae, 38146, 30942},
+	{0xa1d483be383743d4, 56563, 18881},
+	{0xf6f9704b6b7d6ffc, 1990338925, 281641929},
+	{0xbc014a7b53e91135, 743411976, 267127576},
+	{0x9839601e95a81b2e, 1501534047, 1332525004},
+	{0xc4b532a520da1249, 46, 21},
+	{0xf8e2832ba2263a3c, 98, 56},
+	{0x937fd946bae0a420, 96, 56},
+	{0x92049e38ffd89006, 15, 9},
+	{0x1c9b47b9f1ee583c, 80, 5},
+	{0xceb721635beefaed, 1413915450, 771357239},
+	{0x221a8c4667da2058, 7124, 2236},
+	{0xe5f9ef314528fd88, 21, 9},
+	{0x7fc1d18bb536e9cf, 53, 40},
+	{0xc7ab901ab98ce610, 43, 13},
+	{0x49f16b25f0680ea3, 70, 49},
+	{0xbfe7250481a63eba, 1841553884, 1365285798},
+}
+
+var referenceStringTestVectors = []struct {
+	hashFunc func() hash.Hash64
+	key      string
+	buckets  int32
+	expected int32
+}{
+	{NewCRC32, "", 10, 0},
+	{NewCRC32, "a", 1000, 989},
+	{NewCRC32, "localhost", 1000, 37},
+	{NewCRC32, "user:1001", 10, 1},
+	{NewCRC32, "session/7f3a9c", 10, 0},
+	{NewCRC32, "ёлка", 1048576, 592701},
+	{NewCRC32, "中国", 10, 0},
+	{NewCRC32, "The quick brown fox jumps over the lazy dog", 1048576, 278881},
+	{NewCRC64, "", 1000, 0},
+	{NewCRC64, "a", 10, 9},
+	{NewCRC64, "localhost", 1048576, 323334},
+	{NewCRC64, "user:1001", 10, 8},
+	{NewCRC64, "session/7f3a9c", 1048576, 475575},
+	{NewCRC64, "ёлка", 1000, 657},
+	{NewCRC64, "中国", 1048576, 186647},
+	{NewCRC64, "The quick brown fox jumps over the lazy dog", 10, 3},
+	{NewFNV1, "", 1000, 266},
+	{NewFNV1, "a", 1000, 26},
+	{NewFNV1, "localhost", 1000, 138},
+	{NewFNV1, "user:1001", 10, 7},
+	{NewFNV1, "session/7f3a9c", 1048576, 663236},
+	{NewFNV1, "ёлка", 1048576, 711653},
+	{NewFNV1, "中国", 1000, 788},
+	{NewFNV1, "The quick brown fox jumps over the lazy dog", 10, 9},
+	{NewFNV1a, "", 1000, 266},
+	{NewFNV1a, "a", 10, 2},
+	{NewFNV1a, "localhost", 1000, 31},
+	{NewFNV1a, "user:1001", 1048576, 781166},
+	{NewFNV1a, "session/7f3a9c", 1000, 232},
+	{NewFNV1a, "ёлка", 1000, 772},
+	{NewFNV1a, "中国", 10, 5},
+	{NewFNV1a, "The quick brown fox jumps over the lazy dog", 1000, 809},
+	{NewXXHash, "", 10, 7},
+	{NewXXHash, "a", 10, 8},
+	{NewXXHash, "localhost", 1048576, 965824},
+	{NewXXHash, "user:1001", 1048576, 397071},
+	{NewXXHash, "session/7f3a9c", 10, 2},
+	{NewXXHash, "ёлка", 10, 6},
+	{NewXXHash, "中国", 1048576, 410131},
+	{NewXXHash, "The quick brown fox jumps over the lazy dog", 1048576, 891998},
+}
+
+func TestHashReferenceVectors(t *testing.T) {
+	for _, v := range referenceTestVectors {
+		if h := Hash(v.key, v.buckets); h != v.expected {
+			t.Errorf("Hash(%#x, %d) = %d, want %d", v.key, v.buckets, h, v.expected)
+		}
+	}
+	for _, v := range referenceStringTestVectors {
+		if h := HashString(v.key, v.buckets, v.hashFunc()); h != v.expected {
+			t.Errorf("HashString(%s, %d) = %d, want %d", strconv.Quote(v.key), v.buckets, h, v.expected)
+		}
+	}
+}
+
+func TestXXHash(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+	}
+	for _, tt := range tests {
+		h := NewXXHash()
+		h.Write([]byte(tt.in))
+		if got := h.Sum64(); got != tt.want {
+			t.Errorf("xxhash(%q) = %#x, want %#x", tt.in, got, tt.want)
+		}
+
+		// Writing in small pieces must not change the digest.
+		h.Reset()
+		for i := 0; i < len(tt.in); i += 3 {
+			h.Write([]byte(tt.in[i:min(i+3, len(tt.in))]))
+		}
+		if got := h.Sum64(); got != tt.want {
+			t.Errorf("xxhash(%q) written in pieces = %#x, want %#x", tt.in, got, tt.want)
+		}
+	}
+}
+
 func TestHashFunc(t *testing.T) {
 	for _, v := range jumpStringTestVectors {
 		hashFunc := New(int(v.buckets), v.hashFunc())
@@ -66,6 +529,227 @@ func TestHashFunc(t *testing.T) {
 	}
 }
 
+func TestHashFuncPooled(t *testing.T) {
+	for _, v := range jumpStringTestVectors {
+		hashFunc := NewPooled(int(v.buckets), v.hashFunc)
+		if h := hashFunc.Hash(v.key); int32(h) != v.expected {
+			t.Errorf("expected bucket for key=%s to be %d, got %d",
+				strconv.Quote(v.key), v.expected, h)
+		}
+		if h := hashFunc.HashBytes([]byte(v.key)); int32(h) != v.expected {
+			t.Errorf("HashBytes: expected bucket for key=%s to be %d, got %d",
+				strconv.Quote(v.key), v.expected, h)
+		}
+	}
+
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+	pooled, locked := NewPooled(100, NewFNV1a), New(100, NewFNV1a())
+	want := locked.HashAll(keys)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, key := range keys {
+				if got := pooled.Hash(key); got != want[i] {
+					t.Errorf("pooled Hash(%q) = %d, want %d", key, got, want[i])
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestHashFuncHashBytes(t *testing.T) {
+	for _, v := range jumpStringTestVectors {
+		hashFunc := New(int(v.buckets), v.hashFunc())
+		h := hashFunc.HashBytes([]byte(v.key))
+		if int32(h) != v.expected {
+			t.Errorf("expected bucket for key=%s to be %d, got %d",
+				strconv.Quote(v.key), v.expected, h)
+		}
+	}
+}
+
+func TestHashFuncConcurrent(t *testing.T) {
+	h := New(1000, NewFNV1a())
+	want := h.Hash("tenant/object")
+
+	results := make([]int, 1000)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Interleave other keys so that a missing Reset or an unguarded
+			// write would corrupt the hasher state.
+			if i%2 == 0 {
+				h.HashBytes([]byte("other-" + strconv.Itoa(i)))
+			}
+			results[i] = h.Hash("tenant/object")
+		}(i)
+	}
+	wg.Wait()
+
+	for i, got := range results {
+		if got != want {
+			t.Fatalf("call %d: Hash() = %d, want %d", i, got, want)
+		}
+	}
+}
+
+func TestHashFuncHashAll(t *testing.T) {
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+	h := New(57, NewXXHash())
+	got := h.HashAll(keys)
+	if len(got) != len(keys) {
+		t.Fatalf("HashAll() returned %d buckets, want %d", len(got), len(keys))
+	}
+	for i, key := range keys {
+		if want := h.Hash(key); got[i] != want {
+			t.Fatalf("HashAll()[%d] = %d, want Hash(%q) = %d", i, got[i], key, want)
+		}
+	}
+	if got := h.HashAll(nil); len(got) != 0 {
+		t.Errorf("HashAll(nil) = %v, want empty", got)
+	}
+}
+
+func TestHashFuncDistribution(t *testing.T) {
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+	h := New(10, NewFNV1a())
+
+	counts := h.Distribution(keys)
+	if len(counts) != 10 {
+		t.Fatalf("Distribution() returned %d buckets, want 10", len(counts))
+	}
+	var total int
+	for b, count := range counts {
+		total += count
+		if count < 900 || count > 1100 {
+			t.Errorf("bucket %d got %d keys, want about 1000", b, count)
+		}
+	}
+	if total != len(keys) {
+		t.Errorf("Distribution() counted %d keys, want %d", total, len(keys))
+	}
+	if counts := New(0, NewFNV1a()).Distribution(keys); len(counts) != 1 || counts[0] != len(keys) {
+		t.Errorf("Distribution() with no buckets = %v, want every key in bucket 0", counts)
+	}
+}
+
+func TestHashFuncRebalanceReport(t *testing.T) {
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+	h := New(10, NewFNV1a())
+
+	if moved, ratio := h.RebalanceReport(keys, 10, 10); moved != 0 || ratio != 0 {
+		t.Errorf("expected no movement for an unchanged bucket count, got %d (%v)", moved, ratio)
+	}
+	if moved, ratio := h.RebalanceReport(nil, 10, 11); moved != 0 || ratio != 0 {
+		t.Errorf("expected no movement for no keys, got %d (%v)", moved, ratio)
+	}
+
+	// Growing from 10 to 11 buckets should move about 1/11 of the keys.
+	moved, ratio := h.RebalanceReport(keys, 10, 11)
+	if ratio < 0.07 || ratio > 0.11 {
+		t.Errorf("expected about 1/11 of keys to move, got %d (%v)", moved, ratio)
+	}
+}
+
+// failingHash is a KeyHashFunc whose writes always fail.
+type failingHash struct{}
+
+var errFailingHash = errors.New("write failed")
+
+func (failingHash) Write(p []byte) (int, error) { return 0, errFailingHash }
+func (failingHash) Reset()                      {}
+func (failingHash) Sum64() uint64               { return 0 }
+
+func TestHashFuncFingerprint(t *testing.T) {
+	hashers := []func() hash.Hash64{
+		NewCRC32, NewCRC64, NewFNV1, NewFNV1a, NewXXHash,
+		func() hash.Hash64 { return crc64.New(crc64.MakeTable(crc64.ISO)) },
+	}
+	seen := make(map[uint64]string)
+	for i, newHash := range hashers {
+		for _, n := range []int{1, 10, 11, 1000} {
+			fp := New(n, newHash()).Fingerprint()
+			if again := New(n, newHash()).Fingerprint(); again != fp {
+				t.Errorf("hasher %d, n=%d: fingerprints %#x and %#x differ", i, n, fp, again)
+			}
+			id := fmt.Sprintf("hasher %d, n=%d", i, n)
+			if other, ok := seen[fp]; ok {
+				t.Errorf("%s has the same fingerprint as %s", id, other)
+			}
+			seen[fp] = id
+		}
+	}
+
+	// Fingerprint leaves the hasher ready for Hash.
+	h := New(10, NewFNV1a())
+	want := h.Hash("localhost")
+	h.Fingerprint()
+	if got := h.Hash("localhost"); got != want {
+		t.Errorf("Hash() after Fingerprint() = %d, want %d", got, want)
+	}
+}
+
+func TestHashFields(t *testing.T) {
+	h := NewFNV1a()
+	key := HashFields(1000, h, []byte("tenant"), []byte("object"), []byte("v1"))
+
+	var manual []byte
+	for _, field := range []string{"tenant", "object", "v1"} {
+		manual = binary.LittleEndian.AppendUint64(manual, uint64(len(field)))
+		manual = append(manual, field...)
+	}
+	if want := HashString(string(manual), 1000, h); key != want {
+		t.Errorf("HashFields() = %d, want %d for the documented encoding", key, want)
+	}
+
+	a := HashFields(1<<30, h, []byte("ab"), []byte("c"))
+	b := HashFields(1<<30, h, []byte("a"), []byte("bc"))
+	if a == b {
+		t.Errorf("HashFields() does not separate fields: both %d", a)
+	}
+}
+
+func TestHashStringE(t *testing.T) {
+	for _, v := range jumpStringTestVectors {
+		h, err := HashStringE(v.key, v.buckets, v.hashFunc())
+		if err != nil || h != v.expected {
+			t.Errorf("expected bucket for key=%s to be %d, got %d (%v)",
+				strconv.Quote(v.key), v.expected, h, err)
+		}
+
+		hashFunc := New(int(v.buckets), v.hashFunc())
+		if h, err := hashFunc.HashE(v.key); err != nil || int32(h) != v.expected {
+			t.Errorf("expected bucket for key=%s to be %d, got %d (%v)",
+				strconv.Quote(v.key), v.expected, h, err)
+		}
+	}
+
+	if _, err := HashStringE("key", 10, failingHash{}); err != errFailingHash {
+		t.Errorf("HashStringE() error = %v, want %v", err, errFailingHash)
+	}
+	if _, err := New(10, failingHash{}).HashE("key"); err != errFailingHash {
+		t.Errorf("HashE() error = %v, want %v", err, errFailingHash)
+	}
+}
+
 func ExampleHash() {
 	fmt.Print(Hash(256, 1024))
 	// Output: 520
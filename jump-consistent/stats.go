@@ -0,0 +1,177 @@
+package jump
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrOutOfRange is returned by CheckRange for a bucket outside [0, buckets).
+var ErrOutOfRange = errors.New("bucket out of range")
+
+// InRange reports whether bucket is a valid result for buckets buckets, i.e.
+// in [0, buckets). Like Hash, it treats buckets <= 0 as 1.
+func InRange(bucket, buckets int32) bool {
+	if buckets <= 0 {
+		buckets = 1
+	}
+	return bucket >= 0 && bucket < buckets
+}
+
+// CheckRange hashes every key with hash, or Hash if hash is nil, and returns
+// an error wrapping ErrOutOfRange for the first bucket that is not InRange.
+// It lets tests of code built on jump hash assert the bucket range without
+// reimplementing it.
+func CheckRange(keys []uint64, buckets int32, hash func(key uint64, buckets int32) int32) error {
+	if hash == nil {
+		hash = Hash
+	}
+	for _, key := range keys {
+		if b := hash(key, buckets); !InRange(b, buckets) {
+			return fmt.Errorf("%w: key %#x mapped to bucket %d of %d", ErrOutOfRange, key, b, buckets)
+		}
+	}
+	return nil
+}
+
+// ChiSquared returns Pearson's chi-squared statistic of the bucket counts of
+// keys against a uniform distribution over buckets. Lower is more uniform.
+func ChiSquared(keys []uint64, buckets int32) float64 {
+	if buckets <= 0 {
+		buckets = 1
+	}
+	if len(keys) == 0 {
+		return 0
+	}
+
+	counts := make([]int, buckets)
+	for _, key := range keys {
+		counts[Hash(key, buckets)]++
+	}
+
+	expected := float64(len(keys)) / float64(buckets)
+	var chi2 float64
+	for _, count := range counts {
+		d := float64(count) - expected
+		chi2 += d * d / expected
+	}
+	return chi2
+}
+
+// UniformityP returns the p-value of ChiSquared(keys, buckets) with
+// buckets-1 degrees of freedom: the probability that a truly uniform
+// placement would look at least this skewed. Values close to 0 indicate the
+// keys are not spread evenly.
+func UniformityP(keys []uint64, buckets int32) float64 {
+	if buckets <= 1 || len(keys) == 0 {
+		return 1
+	}
+	df := float64(buckets - 1)
+	return gammaQ(df/2, ChiSquared(keys, buckets)/2)
+}
+
+// MoveFraction returns the expected fraction of keys that change bucket when
+// the bucket count changes from from to to. Jump hash only moves keys into
+// added buckets or out of removed ones, so it is |to-from| / max(from, to).
+func MoveFraction(from, to int) float64 {
+	if from < 1 {
+		from = 1
+	}
+	if to < 1 {
+		to = 1
+	}
+	if from > to {
+		from, to = to, from
+	}
+	return float64(to-from) / float64(to)
+}
+
+// ScalePlan returns the bucket counts to step through when scaling from
+// from to to buckets, ending with to, such that each step moves at most
+// maxMovePerStep of the keys according to MoveFraction. Each step is as
+// large as the limit allows, but changes the count by at least one bucket,
+// so a one-bucket step that exceeds the limit (e.g. 1 to 2 buckets, which
+// moves half the keys) is taken anyway. It returns nil if from == to.
+func ScalePlan(from, to int, maxMovePerStep float64) []int {
+	if from < 1 {
+		from = 1
+	}
+	if to < 1 {
+		to = 1
+	}
+
+	var plan []int
+	for n := from; n != to; {
+		var next int
+		if to > n {
+			// Largest m with (m-n)/m <= maxMovePerStep, at least n+1.
+			m := to
+			if maxMovePerStep < 1 {
+				m = int(math.Min(float64(to), math.Floor(float64(n)/(1-maxMovePerStep))))
+			}
+			for m > n+1 && MoveFraction(n, m) > maxMovePerStep {
+				m--
+			}
+			next = max(m, n+1)
+		} else {
+			// Smallest m with (n-m)/n <= maxMovePerStep, at most n-1.
+			m := int(math.Max(float64(to), math.Ceil(float64(n)*(1-maxMovePerStep))))
+			for m < n-1 && MoveFraction(n, m) > maxMovePerStep {
+				m++
+			}
+			next = min(m, n-1)
+		}
+		plan = append(plan, next)
+		n = next
+	}
+	return plan
+}
+
+// gammaQ is the regularized upper incomplete gamma function Q(a, x).
+func gammaQ(a, x float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+	lgamma, _ := math.Lgamma(a)
+	prefix := math.Exp(-x + a*math.Log(x) - lgamma)
+
+	if x < a+1 {
+		// Series expansion of P(a, x).
+		sum := 1 / a
+		term := sum
+		for n := 1.0; n < 1000; n++ {
+			term *= x / (a + n)
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*1e-15 {
+				break
+			}
+		}
+		return 1 - sum*prefix
+	}
+
+	// Continued fraction for Q(a, x), evaluated with the modified Lentz method.
+	const tiny = 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for i := 1.0; i < 1000; i++ {
+		an := -i * (i - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-15 {
+			break
+		}
+	}
+	return prefix * h
+}
@@ -0,0 +1,152 @@
+package jump
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestGammaQ(t *testing.T) {
+	// Reference values of the chi-squared survival function.
+	tests := []struct {
+		df, chi2, want float64
+	}{
+		{1, 3.841458820694124, 0.05},
+		{2, 5.991464547107979, 0.05},
+		{10, 18.307038053275146, 0.05},
+		{10, 2.5582121601872063, 0.99},
+		{100, 124.34211340400407, 0.05},
+	}
+	for _, tt := range tests {
+		if got := gammaQ(tt.df/2, tt.chi2/2); math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("gammaQ(%v, %v) = %v, want %v", tt.df/2, tt.chi2/2, got, tt.want)
+		}
+	}
+}
+
+func TestChiSquared(t *testing.T) {
+	keys := make([]uint64, 100000)
+	for i := range keys {
+		keys[i] = uint64(i) * 0x9E3779B97F4A7C15
+	}
+
+	if got := ChiSquared(nil, 10); got != 0 {
+		t.Errorf("ChiSquared(nil) = %v, want 0", got)
+	}
+	if got := UniformityP(keys, 1); got != 1 {
+		t.Errorf("UniformityP() with one bucket = %v, want 1", got)
+	}
+
+	if p := UniformityP(keys, 100); p < 0.001 {
+		t.Errorf("UniformityP() for well-spread keys = %v, chi2 = %v", p, ChiSquared(keys, 100))
+	}
+
+	// Every key is the same, so a single bucket gets everything.
+	same := make([]uint64, 1000)
+	if p := UniformityP(same, 100); p > 1e-9 {
+		t.Errorf("UniformityP() for identical keys = %v, want close to 0", p)
+	}
+}
+
+func TestMoveFraction(t *testing.T) {
+	tests := []struct {
+		from, to int
+		want     float64
+	}{
+		{10, 10, 0},
+		{10, 20, 0.5},
+		{20, 10, 0.5},
+		{3, 4, 0.25},
+		{0, 2, 0.5},
+	}
+	for _, tt := range tests {
+		if got := MoveFraction(tt.from, tt.to); got != tt.want {
+			t.Errorf("MoveFraction(%d, %d) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+
+	// The measured fraction matches.
+	moved := 0
+	for key := uint64(0); key < 100000; key++ {
+		if Hash(key*0x9E3779B97F4A7C15, 30) != Hash(key*0x9E3779B97F4A7C15, 40) {
+			moved++
+		}
+	}
+	if got := float64(moved) / 100000; math.Abs(got-MoveFraction(30, 40)) > 0.01 {
+		t.Errorf("moved %v of the keys from 30 to 40 buckets, want about %v", got, MoveFraction(30, 40))
+	}
+}
+
+func TestScalePlan(t *testing.T) {
+	tests := []struct {
+		from, to int
+		maxMove  float64
+		want     []int
+	}{
+		{10, 10, 0.1, nil},
+		{10, 20, 1, []int{20}},
+		{10, 20, 0.5, []int{20}},
+		{10, 20, 0.2, []int{12, 15, 18, 20}},
+		{20, 10, 0.2, []int{16, 13, 11, 10}},
+		{1, 4, 0.3, []int{2, 3, 4}},
+		{4, 1, 0, []int{3, 2, 1}},
+	}
+	for _, tt := range tests {
+		got := ScalePlan(tt.from, tt.to, tt.maxMove)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ScalePlan(%d, %d, %v) = %v, want %v", tt.from, tt.to, tt.maxMove, got, tt.want)
+		}
+	}
+
+	plan := ScalePlan(100, 100000, 0.25)
+	n := 100
+	for _, next := range plan {
+		if f := MoveFraction(n, next); f > 0.25 {
+			t.Errorf("step %d -> %d moves %v of the keys", n, next, f)
+		}
+		n = next
+	}
+	if n != 100000 {
+		t.Errorf("plan %v ends at %d, want 100000", plan, n)
+	}
+}
+
+func TestInRange(t *testing.T) {
+	tests := []struct {
+		bucket, buckets int32
+		want            bool
+	}{
+		{0, 1, true},
+		{9, 10, true},
+		{10, 10, false},
+		{-1, 10, false},
+		{0, 0, true},
+		{1, -5, false},
+	}
+	for _, tt := range tests {
+		if got := InRange(tt.bucket, tt.buckets); got != tt.want {
+			t.Errorf("InRange(%d, %d) = %v, want %v", tt.bucket, tt.buckets, got, tt.want)
+		}
+	}
+}
+
+func TestCheckRange(t *testing.T) {
+	keys := make([]uint64, 10000)
+	for i := range keys {
+		keys[i] = uint64(i) * 0x9E3779B97F4A7C15
+	}
+	for _, buckets := range []int32{-1, 0, 1, 7, 1000, math.MaxInt32} {
+		if err := CheckRange(keys, buckets, nil); err != nil {
+			t.Errorf("CheckRange(Hash, %d) returned %v", buckets, err)
+		}
+		if err := CheckRange(keys, buckets, HashFixedPoint); err != nil {
+			t.Errorf("CheckRange(HashFixedPoint, %d) returned %v", buckets, err)
+		}
+	}
+
+	offByOne := func(key uint64, buckets int32) int32 { return Hash(key, buckets) + 1 }
+	if err := CheckRange(keys, 10, offByOne); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("CheckRange() with an off-by-one hash returned %v, want ErrOutOfRange", err)
+	}
+}
@@ -0,0 +1,110 @@
+package jump
+
+import (
+	"sort"
+	"sync"
+)
+
+// WeightedCluster maps string keys to weighted nodes. A node of weight w owns
+// w virtual buckets of a jump-hash bucket space, and a key belongs to the node
+// owning its virtual bucket.
+//
+// Raising a node's weight revives dead virtual buckets or appends new ones, so
+// keys only move onto that node; lowering it marks the node's highest virtual
+// buckets dead, so keys only move off it. Either way the fraction of keys that
+// moves is proportional to the weight change. Dead buckets at the end of the
+// space are trimmed, which undoes an earlier growth exactly but may shift keys
+// that were being re-probed away from other dead buckets.
+//
+// WeightedCluster is safe for concurrent use.
+type WeightedCluster struct {
+	mu       sync.Mutex
+	owners   []string         // virtual bucket -> node, "" for a dead bucket
+	vbuckets map[string][]int // node -> virtual buckets, ascending
+	h        KeyHashFunc
+}
+
+// NewWeightedCluster creates a WeightedCluster. Virtual buckets are assigned
+// in node name order so that the layout does not depend on map iteration.
+func NewWeightedCluster(nodes map[string]int, h KeyHashFunc) *WeightedCluster {
+	c := &WeightedCluster{
+		vbuckets: make(map[string][]int, len(nodes)),
+		h:        h,
+	}
+	names := make([]string, 0, len(nodes))
+	for node := range nodes {
+		names = append(names, node)
+	}
+	sort.Strings(names)
+	for _, node := range names {
+		c.setWeight(node, nodes[node])
+	}
+	return c
+}
+
+// SetWeight sets the weight of node, adding it if needed. A weight of zero or
+// less removes the node.
+func (c *WeightedCluster) SetWeight(node string, weight int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.setWeight(node, weight)
+}
+
+// Remove removes node. Removing a node that is not present is a no-op.
+func (c *WeightedCluster) Remove(node string) {
+	c.SetWeight(node, 0)
+}
+
+// Weight returns the weight of node, or 0 if it is not present.
+func (c *WeightedCluster) Weight(node string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.vbuckets[node])
+}
+
+func (c *WeightedCluster) setWeight(node string, weight int) {
+	owned := c.vbuckets[node]
+	for len(owned) > weight && len(owned) > 0 {
+		last := owned[len(owned)-1]
+		c.owners[last] = ""
+		owned = owned[:len(owned)-1]
+	}
+	for b := 0; len(owned) < weight && b < len(c.owners); b++ {
+		if c.owners[b] == "" {
+			c.owners[b] = node
+			owned = append(owned, b)
+		}
+	}
+	for len(owned) < weight {
+		owned = append(owned, len(c.owners))
+		c.owners = append(c.owners, node)
+	}
+	sort.Ints(owned)
+	for len(c.owners) > 0 && c.owners[len(c.owners)-1] == "" {
+		c.owners = c.owners[:len(c.owners)-1]
+	}
+
+	if len(owned) == 0 {
+		delete(c.vbuckets, node)
+		return
+	}
+	c.vbuckets[node] = owned
+}
+
+// Get returns the node responsible for key, or "" if the cluster is empty.
+func (c *WeightedCluster) Get(key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.vbuckets) == 0 {
+		return ""
+	}
+	c.h.Reset()
+	_, err := writeString(c.h, key)
+	if err != nil {
+		panic(err)
+	}
+	return c.owners[liveBucket(c.h.Sum64(), c.owners)]
+}
@@ -0,0 +1,100 @@
+package jump
+
+import (
+	"math"
+	"testing"
+)
+
+func weightedPlacement(c *WeightedCluster, keys []string) map[string]string {
+	res := make(map[string]string, len(keys))
+	for _, key := range keys {
+		res[key] = c.Get(key)
+	}
+	return res
+}
+
+func TestWeightedClusterDistribution(t *testing.T) {
+	keys := clusterKeys(20000)
+	weights := map[string]int{"a": 1, "b": 2, "c": 3, "d": 4}
+	c := NewWeightedCluster(weights, NewFNV1a())
+
+	counts := make(map[string]int)
+	for _, node := range weightedPlacement(c, keys) {
+		counts[node]++
+	}
+	for node, weight := range weights {
+		want := float64(len(keys)*weight) / 10
+		if math.Abs(float64(counts[node])-want) > 0.1*want {
+			t.Errorf("node %s got %d keys, want about %v", node, counts[node], want)
+		}
+	}
+}
+
+func TestWeightedClusterRemoveBalance(t *testing.T) {
+	weights := map[string]int{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}
+	c := NewWeightedCluster(weights, NewXXHash())
+	c.Remove("c")
+	delete(weights, "c")
+
+	keys := clusterKeys(200000)
+	counts := make(map[string]int)
+	for _, node := range weightedPlacement(c, keys) {
+		counts[node]++
+	}
+	for node, weight := range weights {
+		want := float64(len(keys)*weight) / 12
+		if math.Abs(float64(counts[node])-want) > 0.03*want {
+			t.Errorf("node %s got %d keys after removing c, want about %v", node, counts[node], want)
+		}
+	}
+}
+
+func TestWeightedClusterSetWeight(t *testing.T) {
+	keys := clusterKeys(20000)
+	c := NewWeightedCluster(map[string]int{"a": 1, "b": 1, "c": 1, "d": 1}, NewFNV1a())
+	before := weightedPlacement(c, keys)
+
+	// Bumping one node from 1 to 2 grows the space from 4 to 5 virtual
+	// buckets, so 1/5 of keys land on the new bucket, all owned by that node.
+	// A quarter of those already belonged to it, so about 3/20 actually move.
+	c.SetWeight("b", 2)
+	if c.Weight("b") != 2 {
+		t.Fatalf("Weight(b) = %d, want 2", c.Weight("b"))
+	}
+	after := weightedPlacement(c, keys)
+	var moved int
+	for _, key := range keys {
+		if before[key] == after[key] {
+			continue
+		}
+		if after[key] != "b" {
+			t.Fatalf("key %s moved from %s to %s instead of the heavier node", key, before[key], after[key])
+		}
+		moved++
+	}
+	if ratio := float64(moved) / float64(len(keys)); math.Abs(ratio-0.15) > 0.02 {
+		t.Errorf("expected about 3/20 of keys to move, got %v", ratio)
+	}
+
+	// Dropping back to 1 only moves keys off that node, restoring the
+	// original placement.
+	c.SetWeight("b", 1)
+	for key, node := range weightedPlacement(c, keys) {
+		if node != before[key] {
+			t.Fatalf("key %s routed to %s after restoring weight, want %s", key, node, before[key])
+		}
+	}
+
+	c.Remove("a")
+	for key, node := range weightedPlacement(c, keys) {
+		if node == "a" || (before[key] != "a" && node != before[key]) {
+			t.Fatalf("key %s routed to %s after removing a, was %s", key, node, before[key])
+		}
+	}
+	for _, node := range []string{"b", "c", "d"} {
+		c.Remove(node)
+	}
+	if got := c.Get("key"); got != "" {
+		t.Errorf("Get() on empty cluster = %q, want empty", got)
+	}
+}
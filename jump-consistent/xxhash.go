@@ -0,0 +1,123 @@
+package jump
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// xxHash64 with seed 0, see
+// https://github.com/Cyan4973/xxHash/blob/dev/doc/xxhash_spec.md
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+type xxHashFunc struct {
+	v     [4]uint64
+	total uint64
+	mem   [32]byte
+	n     int // bytes buffered in mem
+}
+
+func newXXHash() *xxHashFunc {
+	h := &xxHashFunc{}
+	h.Reset()
+	return h
+}
+
+func (h *xxHashFunc) Write(p []byte) (n int, err error) {
+	n = len(p)
+	h.total += uint64(n)
+
+	if h.n+len(p) < 32 {
+		h.n += copy(h.mem[h.n:], p)
+		return n, nil
+	}
+	if h.n > 0 {
+		c := copy(h.mem[h.n:], p)
+		h.stripe(h.mem[:])
+		p = p[c:]
+		h.n = 0
+	}
+	for ; len(p) >= 32; p = p[32:] {
+		h.stripe(p)
+	}
+	h.n = copy(h.mem[:], p)
+	return n, nil
+}
+
+// stripe consumes the first 32 bytes of p.
+func (h *xxHashFunc) stripe(p []byte) {
+	for i := range h.v {
+		h.v[i] = xxRound(h.v[i], binary.LittleEndian.Uint64(p[8*i:]))
+	}
+}
+
+func (h *xxHashFunc) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint64(b, h.Sum64())
+}
+
+func (h *xxHashFunc) Reset() {
+	// The seed offsets wrap around, so they are computed at run time.
+	p1, p2 := xxPrime1, xxPrime2
+	h.v = [4]uint64{p1 + p2, p2, 0, -p1}
+	h.total = 0
+	h.n = 0
+}
+
+func (h *xxHashFunc) Size() int {
+	return 8
+}
+
+func (h *xxHashFunc) BlockSize() int {
+	return 32
+}
+
+func (h *xxHashFunc) Sum64() uint64 {
+	var acc uint64
+	if h.total >= 32 {
+		acc = bits.RotateLeft64(h.v[0], 1) + bits.RotateLeft64(h.v[1], 7) +
+			bits.RotateLeft64(h.v[2], 12) + bits.RotateLeft64(h.v[3], 18)
+		for _, v := range h.v {
+			acc = (acc^xxRound(0, v))*xxPrime1 + xxPrime4
+		}
+	} else {
+		acc = xxPrime5
+	}
+	acc += h.total
+
+	p := h.mem[:h.n]
+	for ; len(p) >= 8; p = p[8:] {
+		acc ^= xxRound(0, binary.LittleEndian.Uint64(p))
+		acc = bits.RotateLeft64(acc, 27)*xxPrime1 + xxPrime4
+	}
+	if len(p) >= 4 {
+		acc ^= uint64(binary.LittleEndian.Uint32(p)) * xxPrime1
+		acc = bits.RotateLeft64(acc, 23)*xxPrime2 + xxPrime3
+		p = p[4:]
+	}
+	for _, b := range p {
+		acc ^= uint64(b) * xxPrime5
+		acc = bits.RotateLeft64(acc, 11) * xxPrime1
+	}
+
+	acc ^= acc >> 33
+	acc *= xxPrime2
+	acc ^= acc >> 29
+	acc *= xxPrime3
+	acc ^= acc >> 32
+	return acc
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+var _ hash.Hash64 = (*xxHashFunc)(nil)
@@ -1,73 +1,734 @@
 package rendezvous
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrEmptyKey = errors.New("empty key")
+	ErrNoNodes  = errors.New("no nodes")
+)
+
+// Rendezvous is safe for concurrent use. Lookups read an immutable snapshot of
+// the node set without locking; Add and Remove serialize on a mutex and
+// publish a new snapshot.
 type Rendezvous struct {
-	nodes map[string]int
-	nStr  []string
-	nHash []uint64
-	hash  HashFunc
+	mu        sync.Mutex
+	state     atomic.Pointer[state]
+	hash      HashFunc
+	hashBytes BytesHashFunc // nil unless created with NewBytes
+	replicas  int           // virtual nodes per node, see NewWithReplicas
+	// weightReplicas derives each node's virtual node count from its weight,
+	// see NewWeightedReplicas.
+	weightReplicas bool
+
+	// TieBreak reports whether node a wins over node b when both score the
+	// same for a key. When nil, the lexically smaller name wins. It must be
+	// set before the Rendezvous is used and not changed afterwards.
+	TieBreak func(a, b string) bool
+	// Priority ranks nodes for LookupFailover, higher first. When nil,
+	// LookupFailover is LookupN. The same rules as for TieBreak apply.
+	Priority func(node string) int
+}
+
+// state is an immutable view of the node set. It is never modified after
+// being published.
+type state struct {
+	nodes   map[string]int
+	nStr    []string
+	nHash   []uint64
+	nWeight []float64
+	nInvW   []float64  // 1/nWeight, precomputed for LookupWeighted
+	vHash   [][]uint64 // hashes of each node's extra virtual nodes
+	// uniform reports that all weights are equal, letting LookupWeighted use
+	// the plain Lookup scoring.
+	uniform bool
 }
 
 type HashFunc func(s string) uint64
 
+// BytesHashFunc hashes binary keys. It must agree with the HashFunc used for
+// the same Rendezvous, i.e. hash([]byte(s)) == hash(s).
+type BytesHashFunc func(b []byte) uint64
+
+// New creates a Rendezvous over nodes. Nodes are kept sorted by name so that
+// Lookup depends only on the set of nodes, not on the order they were given
+// or the history of Add and Remove calls.
 func New(nodes []string, hash HashFunc) *Rendezvous {
-	r := &Rendezvous{
-		nodes: make(map[string]int, len(nodes)),
-		nStr:  make([]string, len(nodes)),
-		nHash: make([]uint64, len(nodes)),
-		hash:  hash,
+	weights := make(map[string]float64, len(nodes))
+	for _, n := range nodes {
+		weights[n] = 1
 	}
+	return newWeighted(&Rendezvous{hash: hash}, weights)
+}
 
-	for i, n := range nodes {
-		r.nodes[n] = i
-		r.nStr[i] = n
-		r.nHash[i] = hash(n)
+// NewWithReplicas is like New but scores every node as replicas virtual
+// nodes, a node's score being the best of its virtual nodes, at the cost of
+// replicas hashes per node and lookup. Virtual node 0 uses the node's own hash
+// and virtual node i > 0 the hash of node+"#"+i, so with replicas <= 1 it is
+// the same as New.
+//
+// Unlike on a consistent hash ring, virtual nodes do not improve balance:
+// every node already wins a key with equal probability, and with a
+// well-mixed HashFunc the imbalance of plain rendezvous hashing is at the
+// level of sampling noise.
+func NewWithReplicas(nodes []string, hash HashFunc, replicas int) *Rendezvous {
+	weights := make(map[string]float64, len(nodes))
+	for _, n := range nodes {
+		weights[n] = 1
 	}
+	return newWeighted(&Rendezvous{hash: hash, replicas: replicas}, weights)
+}
 
+// NewBytes is like New but takes a hash over []byte, letting LookupBytes hash
+// binary keys without converting them to strings. Lookup and the node hashes
+// use the same function on the string's bytes.
+func NewBytes(nodes []string, hash BytesHashFunc) *Rendezvous {
+	r := New(nodes, func(s string) uint64 { return hash([]byte(s)) })
+	r.hashBytes = hash
 	return r
 }
 
+// Sum64Hasher is the hasher shape used by consistent.HashFunc, so one
+// implementation can serve both packages.
+type Sum64Hasher interface {
+	Sum64([]byte) uint64
+}
+
+// NewFromSum64 is NewBytes with h.Sum64 as the hash.
+func NewFromSum64(nodes []string, h Sum64Hasher) *Rendezvous {
+	return NewBytes(nodes, h.Sum64)
+}
+
+// newWeighted stores the initial snapshot of r, which must not have one yet.
+func newWeighted(r *Rendezvous, nodes map[string]float64) *Rendezvous {
+	st := &state{
+		nodes:   make(map[string]int, len(nodes)),
+		nStr:    make([]string, 0, len(nodes)),
+		nHash:   make([]uint64, 0, len(nodes)),
+		nWeight: make([]float64, 0, len(nodes)),
+		nInvW:   make([]float64, 0, len(nodes)),
+		vHash:   make([][]uint64, 0, len(nodes)),
+	}
+	for n := range nodes {
+		st.nStr = append(st.nStr, n)
+	}
+	sort.Strings(st.nStr)
+	for _, n := range st.nStr {
+		w := r.scoreWeight(nodes[n])
+		st.nHash = append(st.nHash, r.hash(n))
+		st.nWeight = append(st.nWeight, w)
+		st.nInvW = append(st.nInvW, 1/w)
+		st.vHash = append(st.vHash, r.virtualHashes(n, nodes[n]))
+	}
+	st.reindex()
+	r.state.Store(st)
+
+	return r
+}
+
+// Lookup returns the node with the highest score for k, or "" when there are
+// no nodes.
 func (r *Rendezvous) Lookup(k string) string {
-	if len(r.nodes) == 0 {
+	st := r.state.Load()
+	if len(st.nodes) == 0 {
 		return ""
 	}
+	return st.lookup(r.hash(k), r.TieBreak)
+}
 
-	kHash := r.hash(k)
+// LookupBytes is like Lookup for a binary key. It avoids converting k to a
+// string when the Rendezvous was created with NewBytes.
+func (r *Rendezvous) LookupBytes(k []byte) string {
+	st := r.state.Load()
+	if len(st.nodes) == 0 {
+		return ""
+	}
+	if r.hashBytes != nil {
+		return st.lookup(r.hashBytes(k), r.TieBreak)
+	}
+	return st.lookup(r.hash(string(k)), r.TieBreak)
+}
+
+// LookupIndex returns the index of Lookup(k) in Nodes(), or -1 when there are
+// no nodes. Nodes are kept sorted by name, so the index refers to that order
+// rather than the order nodes were passed to New, and it shifts when nodes
+// sorting before it are added or removed.
+func (r *Rendezvous) LookupIndex(k string) int {
+	st := r.state.Load()
+	if len(st.nodes) == 0 {
+		return -1
+	}
+	return st.lookupIndex(r.hash(k), r.TieBreak)
+}
+
+// Nodes returns a copy of the node names in lookup order, sorted by name.
+func (r *Rendezvous) Nodes() []string {
+	st := r.state.Load()
+	return append([]string(nil), st.nStr...)
+}
+
+// Snapshot returns copies of the node names, as Nodes, and of their hashes,
+// as NodeHash, in the same order. Both come from one snapshot of the node
+// set, so they always match even while other goroutines add and remove nodes.
+func (r *Rendezvous) Snapshot() (nodes []string, hashes []uint64) {
+	st := r.state.Load()
+	return append([]string(nil), st.nStr...), append([]uint64(nil), st.nHash...)
+}
 
+// lookup returns the winning node for a key hash. st must not be empty.
+func (st *state) lookup(kHash uint64, tie func(a, b string) bool) string {
+	return st.nStr[st.lookupIndex(kHash, tie)]
+}
+
+// lookupIndex returns the index of the winning node for a key hash. st must
+// not be empty.
+func (st *state) lookupIndex(kHash uint64, tie func(a, b string) bool) int {
 	var mIdx int
-	var mHash = xorShiftMul64(kHash ^ r.nHash[0])
+	var mHash = st.score(0, kHash)
+
+	// Without tie, ties keep the earlier node, which is the lexically
+	// smallest name.
+	for i := 1; i < len(st.nHash); i++ {
+		if h := st.score(i, kHash); h > mHash || h == mHash && st.wins(i, mIdx, tie) {
+			mIdx = i
+			mHash = h
+		}
+	}
+
+	return mIdx
+}
+
+// wins reports whether node i beats node j on a tied score.
+func (st *state) wins(i, j int, tie func(a, b string) bool) bool {
+	if tie == nil {
+		return i < j
+	}
+	return tie(st.nStr[i], st.nStr[j])
+}
+
+// LookupExcluding is like Lookup but skips nodes in exclude, returning the
+// highest scoring remaining node, or "" if every node is excluded.
+func (r *Rendezvous) LookupExcluding(k string, exclude map[string]bool) string {
+	st := r.state.Load()
+	kHash := r.hash(k)
 
-	for i, nHash := range r.nHash[1:] {
-		if h := xorShiftMul64(kHash ^ nHash); h > mHash {
-			mIdx = i + 1
+	mIdx := -1
+	var mHash uint64
+	for i := range st.nHash {
+		if exclude[st.nStr[i]] {
+			continue
+		}
+		if h := st.score(i, kHash); mIdx < 0 || h > mHash || h == mHash && st.wins(i, mIdx, r.TieBreak) {
+			mIdx = i
 			mHash = h
 		}
 	}
+	if mIdx < 0 {
+		return ""
+	}
+	return st.nStr[mIdx]
+}
+
+// LookupN returns up to n distinct nodes for k, ordered from the highest score
+// down, so the first element is always Lookup(k). The result is capped at the
+// number of nodes: with a single node it holds just that node, and with no
+// nodes or n <= 0 it is nil.
+func (r *Rendezvous) LookupN(k string, n int) []string {
+	st := r.state.Load()
+	if n <= 0 || len(st.nStr) == 0 {
+		return nil
+	}
+	if n > len(st.nStr) {
+		n = len(st.nStr)
+	}
+	return r.rank(st, k)[:n]
+}
+
+// Rank returns every node ordered by descending score for k, breaking ties as
+// Lookup does, or nil when there are no nodes.
+func (r *Rendezvous) Rank(k string) []string {
+	st := r.state.Load()
+	if len(st.nStr) == 0 {
+		return nil
+	}
+	return r.rank(st, k)
+}
+
+type scoredNode struct {
+	score uint64
+	idx   int
+}
+
+// scratchPool holds []scoredNode buffers reused across rank calls.
+var scratchPool = sync.Pool{New: func() any { return new([]scoredNode) }}
+
+func (r *Rendezvous) rank(st *state, k string) []string {
+	buf := scratchPool.Get().(*[]scoredNode)
+	scored := (*buf)[:0]
+
+	kHash := r.hash(k)
+	for i := range st.nHash {
+		scored = append(scored, scoredNode{st.score(i, kHash), i})
+	}
+	sort.SliceStable(scored, func(a, b int) bool {
+		if scored[a].score != scored[b].score {
+			return scored[a].score > scored[b].score
+		}
+		return st.wins(scored[a].idx, scored[b].idx, r.TieBreak)
+	})
+
+	res := make([]string, len(scored))
+	for i, s := range scored {
+		res[i] = st.nStr[s.idx]
+	}
+	*buf = scored
+	scratchPool.Put(buf)
+	return res
+}
+
+// failoverBandShift selects the score bits LookupFailover compares before
+// Priority: scores that agree in their top 8 bits are near-equal.
+const failoverBandShift = 56
+
+// LookupFailover returns up to depth nodes for k in failover order. The first
+// is always Lookup(k). The others are ordered by score as in LookupN, except
+// that near-equal scores, i.e. ones in the same 1/256th of the score range,
+// are ordered by descending Priority, falling back to score order among equal
+// priorities. Priority therefore only reorders neighbours whose scores are
+// within a band; it never moves a node past one that scores in a higher band,
+// so the choice of failover node stays as spread out as with plain HRW. The
+// result is capped at the number of nodes, and nil with no nodes or
+// depth <= 0.
+func (r *Rendezvous) LookupFailover(k string, depth int) []string {
+	st := r.state.Load()
+	if depth <= 0 || len(st.nStr) == 0 {
+		return nil
+	}
+	if depth > len(st.nStr) {
+		depth = len(st.nStr)
+	}
+
+	kHash := r.hash(k)
+	scored := make([]scoredNode, len(st.nHash))
+	for i := range st.nHash {
+		scored[i] = scoredNode{st.score(i, kHash), i}
+	}
+	sort.SliceStable(scored, func(a, b int) bool {
+		if scored[a].score != scored[b].score {
+			return scored[a].score > scored[b].score
+		}
+		return st.wins(scored[a].idx, scored[b].idx, r.TieBreak)
+	})
+	if r.Priority != nil {
+		// The stable sort keeps score order within a band and priority.
+		rest := scored[1:]
+		sort.SliceStable(rest, func(a, b int) bool {
+			bandA, bandB := rest[a].score>>failoverBandShift, rest[b].score>>failoverBandShift
+			if bandA != bandB {
+				return bandA > bandB
+			}
+			return r.Priority(st.nStr[rest[a].idx]) > r.Priority(st.nStr[rest[b].idx])
+		})
+	}
+
+	res := make([]string, depth)
+	for i := range res {
+		res[i] = st.nStr[scored[i].idx]
+	}
+	return res
+}
+
+// LookupExplain returns a human-readable breakdown of Lookup(k) for debugging:
+// the key hash, then every node with its score in descending order, the first
+// being the winner. Scores are xorShiftMul64(keyHash ^ nodeHash), taking the
+// best virtual node when there are replicas.
+func (r *Rendezvous) LookupExplain(k string) string {
+	st := r.state.Load()
+	kHash := r.hash(k)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "key %q hash 0x%016x\n", k, kHash)
+	if len(st.nStr) == 0 {
+		b.WriteString("no nodes\n")
+		return b.String()
+	}
+	for i, n := range r.rank(st, k) {
+		idx := st.nodes[n]
+		fmt.Fprintf(&b, "%d. %s hash 0x%016x score 0x%016x", i+1, n, st.nHash[idx], st.score(idx, kHash))
+		if i == 0 {
+			b.WriteString(" (winner)")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
 
-	return r.nStr[mIdx]
+// LookupStrict is like Lookup but returns ErrEmptyKey for keys that are empty
+// or consist only of whitespace, which usually means the key failed to
+// populate upstream, and ErrNoNodes when there is nothing to route to.
+func (r *Rendezvous) LookupStrict(k string) (string, error) {
+	if strings.TrimSpace(k) == "" {
+		return "", ErrEmptyKey
+	}
+	st := r.state.Load()
+	if len(st.nodes) == 0 {
+		return "", ErrNoNodes
+	}
+	return st.lookup(r.hash(k), r.TieBreak), nil
 }
 
+// Add inserts node at its sorted position with weight 1. Adding a node that is
+// already present is a no-op.
 func (r *Rendezvous) Add(node string) {
-	r.nodes[node] = len(r.nStr)
-	r.nStr = append(r.nStr, node)
-	r.nHash = append(r.nHash, r.hash(node))
+	r.add(node, 1)
 }
 
+func (r *Rendezvous) add(node string, weight float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.state.Load()
+	if _, ok := old.nodes[node]; ok {
+		return
+	}
+
+	idx := sort.SearchStrings(old.nStr, node)
+	r.state.Store(old.insert(idx, node, r.hash(node), r.virtualHashes(node, weight), r.scoreWeight(weight)))
+}
+
+// Remove deletes node, keeping the remaining nodes sorted rather than
+// swapping the last node into its place, so that Lookup ties and LookupIndex
+// stay independent of history. Removing a node that is not present is a
+// no-op.
 func (r *Rendezvous) Remove(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.state.Load()
+
 	// get index of node to remove
-	nIdx := r.nodes[node]
+	nIdx, ok := old.nodes[node]
+	if !ok {
+		return
+	}
+
+	r.state.Store(old.delete(nIdx))
+}
+
+// RemoveIndex deletes the node at index i of Nodes, e.g. as returned by
+// LookupIndex, and returns its name. Like Remove it keeps the remaining nodes
+// sorted, so the index of every later node drops by one. It returns "", false
+// if i is out of range.
+func (r *Rendezvous) RemoveIndex(i int) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.state.Load()
+	if i < 0 || i >= len(old.nStr) {
+		return "", false
+	}
+	node := old.nStr[i]
+	r.state.Store(old.delete(i))
+	return node, true
+}
+
+// AddAll adds every node in nodes with weight 1, publishing a single new
+// snapshot. Nodes that are already present or repeated are skipped.
+func (r *Rendezvous) AddAll(nodes []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.state.Load()
+	added := make([]string, 0, len(nodes))
+	seen := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		if _, ok := old.nodes[n]; ok || seen[n] {
+			continue
+		}
+		seen[n] = true
+		added = append(added, n)
+	}
+	if len(added) == 0 {
+		return
+	}
+	sort.Strings(added)
+
+	r.state.Store(old.merge(added, r))
+}
+
+// RemoveAll removes every node in nodes, publishing a single new snapshot.
+// Nodes that are not present are skipped.
+func (r *Rendezvous) RemoveAll(nodes []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.state.Load()
+	removed := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		if _, ok := old.nodes[n]; ok {
+			removed[n] = true
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+
+	n := len(old.nStr) - len(removed)
+	st := &state{
+		nodes:   make(map[string]int, n),
+		nStr:    make([]string, 0, n),
+		nHash:   make([]uint64, 0, n),
+		nWeight: make([]float64, 0, n),
+		nInvW:   make([]float64, 0, n),
+		vHash:   make([][]uint64, 0, n),
+	}
+	for i, name := range old.nStr {
+		if removed[name] {
+			continue
+		}
+		st.nStr = append(st.nStr, name)
+		st.nHash = append(st.nHash, old.nHash[i])
+		st.nWeight = append(st.nWeight, old.nWeight[i])
+		st.nInvW = append(st.nInvW, old.nInvW[i])
+		st.vHash = append(st.vHash, old.vHash[i])
+	}
+	st.reindex()
+
+	r.state.Store(st)
+}
+
+// merge returns a copy of st with the sorted, absent names added with
+// weight 1, hashed with r.
+func (st *state) merge(names []string, r *Rendezvous) *state {
+	n := len(st.nStr) + len(names)
+	res := &state{
+		nodes:   make(map[string]int, n),
+		nStr:    make([]string, 0, n),
+		nHash:   make([]uint64, 0, n),
+		nWeight: make([]float64, 0, n),
+		nInvW:   make([]float64, 0, n),
+		vHash:   make([][]uint64, 0, n),
+	}
+	i, j := 0, 0
+	for i < len(st.nStr) || j < len(names) {
+		if j == len(names) || (i < len(st.nStr) && st.nStr[i] < names[j]) {
+			res.nStr = append(res.nStr, st.nStr[i])
+			res.nHash = append(res.nHash, st.nHash[i])
+			res.nWeight = append(res.nWeight, st.nWeight[i])
+			res.nInvW = append(res.nInvW, st.nInvW[i])
+			res.vHash = append(res.vHash, st.vHash[i])
+			i++
+			continue
+		}
+		res.nStr = append(res.nStr, names[j])
+		res.nHash = append(res.nHash, r.hash(names[j]))
+		res.nWeight = append(res.nWeight, 1)
+		res.nInvW = append(res.nInvW, 1)
+		res.vHash = append(res.vHash, r.virtualHashes(names[j], 1))
+		j++
+	}
+	res.reindex()
+	return res
+}
+
+// insert returns a copy of st with node added at idx.
+func (st *state) insert(idx int, node string, hash uint64, vHash []uint64, weight float64) *state {
+	n := len(st.nStr) + 1
+	res := &state{
+		nodes:   make(map[string]int, n),
+		nStr:    make([]string, 0, n),
+		nHash:   make([]uint64, 0, n),
+		nWeight: make([]float64, 0, n),
+		nInvW:   make([]float64, 0, n),
+		vHash:   make([][]uint64, 0, n),
+	}
+	res.nStr = append(append(append(res.nStr, st.nStr[:idx]...), node), st.nStr[idx:]...)
+	res.nHash = append(append(append(res.nHash, st.nHash[:idx]...), hash), st.nHash[idx:]...)
+	res.nWeight = append(append(append(res.nWeight, st.nWeight[:idx]...), weight), st.nWeight[idx:]...)
+	res.nInvW = append(append(append(res.nInvW, st.nInvW[:idx]...), 1/weight), st.nInvW[idx:]...)
+	res.vHash = append(append(append(res.vHash, st.vHash[:idx]...), vHash), st.vHash[idx:]...)
+	res.reindex()
+	return res
+}
+
+// delete returns a copy of st without the node at idx.
+func (st *state) delete(idx int) *state {
+	n := len(st.nStr) - 1
+	res := &state{
+		nodes:   make(map[string]int, n),
+		nStr:    make([]string, 0, n),
+		nHash:   make([]uint64, 0, n),
+		nWeight: make([]float64, 0, n),
+		nInvW:   make([]float64, 0, n),
+		vHash:   make([][]uint64, 0, n),
+	}
+	res.nStr = append(append(res.nStr, st.nStr[:idx]...), st.nStr[idx+1:]...)
+	res.nHash = append(append(res.nHash, st.nHash[:idx]...), st.nHash[idx+1:]...)
+	res.nWeight = append(append(res.nWeight, st.nWeight[:idx]...), st.nWeight[idx+1:]...)
+	res.nInvW = append(append(res.nInvW, st.nInvW[:idx]...), st.nInvW[idx+1:]...)
+	res.vHash = append(append(res.vHash, st.vHash[:idx]...), st.vHash[idx+1:]...)
+	res.reindex()
+	return res
+}
+
+// Distribution routes every key in keys with Lookup and returns the number of
+// keys per node. Every node is present, with 0 if it received no keys.
+func (r *Rendezvous) Distribution(keys []string) map[string]int {
+	st := r.state.Load()
+	res := make(map[string]int, len(st.nStr))
+	for _, n := range st.nStr {
+		res[n] = 0
+	}
+	if len(st.nStr) == 0 {
+		return res
+	}
+	for _, k := range keys {
+		res[st.lookup(r.hash(k), r.TieBreak)]++
+	}
+	return res
+}
+
+// StdDev returns the population standard deviation of the counts in a
+// Distribution, or 0 if it is empty.
+func StdDev(dist map[string]int) float64 {
+	if len(dist) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, count := range dist {
+		sum += float64(count)
+	}
+	mean := sum / float64(len(dist))
+	var sq float64
+	for _, count := range dist {
+		sq += (float64(count) - mean) * (float64(count) - mean)
+	}
+	return math.Sqrt(sq / float64(len(dist)))
+}
+
+// Balance returns the coefficient of variation (StdDev over the mean) of
+// Distribution(keys): 0 when every node gets the same number of keys, and
+// larger the more uneven the spread. It returns 0 with no nodes or keys.
+func (r *Rendezvous) Balance(keys []string) float64 {
+	dist := r.Distribution(keys)
+	if len(dist) == 0 || len(keys) == 0 {
+		return 0
+	}
+	return StdDev(dist) / (float64(len(keys)) / float64(len(dist)))
+}
+
+// Clone returns an independent copy of r with the same nodes, weights, hash
+// functions, TieBreak and Priority, e.g. to simulate a membership change and
+// compare lookups against r. The copy shares no node slices with r.
+func (r *Rendezvous) Clone() *Rendezvous {
+	st := r.state.Load()
+	clone := &Rendezvous{
+		hash:           r.hash,
+		hashBytes:      r.hashBytes,
+		replicas:       r.replicas,
+		weightReplicas: r.weightReplicas,
+		TieBreak:       r.TieBreak,
+		Priority:       r.Priority,
+	}
+	cp := &state{
+		nodes:   make(map[string]int, len(st.nStr)),
+		nStr:    append([]string(nil), st.nStr...),
+		nHash:   append([]uint64(nil), st.nHash...),
+		nWeight: append([]float64(nil), st.nWeight...),
+		nInvW:   append([]float64(nil), st.nInvW...),
+		vHash:   make([][]uint64, len(st.vHash)),
+	}
+	for i, v := range st.vHash {
+		if v != nil {
+			cp.vHash[i] = append([]uint64(nil), v...)
+		}
+	}
+	cp.reindex()
+	clone.state.Store(cp)
+	return clone
+}
 
-	// remove from the slices
-	l := len(r.nStr)
-	r.nStr[nIdx] = r.nStr[l]
-	r.nStr = r.nStr[:l]
+// NodeHash returns the hash stored for node, exactly as used by Lookup, and
+// whether the node is present.
+func (r *Rendezvous) NodeHash(node string) (uint64, bool) {
+	st := r.state.Load()
+	idx, ok := st.nodes[node]
+	if !ok {
+		return 0, false
+	}
+	return st.nHash[idx], true
+}
 
-	r.nHash[nIdx] = r.nHash[l]
-	r.nHash = r.nHash[:l]
+// MarshalJSON encodes the node list, in lookup order, as {"nodes":[...]}. It
+// reads a single snapshot, so the output is consistent under concurrent
+// updates.
+func (r *Rendezvous) MarshalJSON() ([]byte, error) {
+	st := r.state.Load()
+	return json.Marshal(struct {
+		Nodes []string `json:"nodes"`
+	}{Nodes: st.nStr})
+}
+
+// reindex rebuilds the nodes map and the uniform flag from the node slices.
+func (st *state) reindex() {
+	for i, n := range st.nStr {
+		st.nodes[n] = i
+	}
+	st.uniform = true
+	for _, w := range st.nWeight {
+		if w != st.nWeight[0] {
+			st.uniform = false
+			break
+		}
+	}
+}
 
-	// update the map
-	delete(r.nodes, node)
-	moved := r.nStr[nIdx]
-	r.nodes[moved] = nIdx
+// virtualHashes returns the hashes of the virtual nodes of a node of the given
+// weight other than the first, or nil without replicas.
+func (r *Rendezvous) virtualHashes(node string, weight float64) []uint64 {
+	count := r.replicas
+	if r.weightReplicas {
+		count = int(math.Round(weight * ReplicasPerWeight))
+	}
+	if count <= 1 {
+		return nil
+	}
+	res := make([]uint64, count-1)
+	for i := range res {
+		res[i] = r.hash(node + "#" + strconv.Itoa(i+1))
+	}
+	return res
+}
+
+// scoreWeight returns the weight LookupWeighted uses for a node added with
+// weight. With weightReplicas the weight is already expressed by the virtual
+// nodes and must not count twice.
+func (r *Rendezvous) scoreWeight(weight float64) float64 {
+	if r.weightReplicas {
+		return 1
+	}
+	return weight
+}
+
+// score returns node i's score for a key hash: the best score of its virtual
+// nodes.
+func (st *state) score(i int, kHash uint64) uint64 {
+	best := xorShiftMul64(kHash ^ st.nHash[i])
+	for _, vHash := range st.vHash[i] {
+		if h := xorShiftMul64(kHash ^ vHash); h > best {
+			best = h
+		}
+	}
+	return best
 }
 
 func xorShiftMul64(x uint64) uint64 {
@@ -1,7 +1,15 @@
 package rendezvous
 
 import (
+	"encoding/json"
+	"fmt"
 	"hash/fnv"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -11,6 +19,12 @@ func hashFunc(s string) uint64 {
 	return h.Sum64()
 }
 
+func hashBytesFunc(b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
+}
+
 func TestLookup(t *testing.T) {
 	type args struct {
 		nodes []string
@@ -37,3 +51,695 @@ func TestLookup(t *testing.T) {
 		})
 	}
 }
+
+func TestLookupIndependentOfHistory(t *testing.T) {
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+
+	a := New([]string{"a", "b", "c", "d", "e"}, hashFunc)
+
+	b := New([]string{"e", "x", "c", "a"}, hashFunc)
+	b.Remove("x")
+	b.Add("d")
+	b.Remove("e")
+	b.Add("b")
+	b.Add("e")
+	b.Add("a")
+
+	as, bs := a.state.Load(), b.state.Load()
+	for i, n := range as.nStr {
+		if bs.nStr[i] != n || bs.nodes[n] != i || bs.nHash[i] != as.nHash[i] {
+			t.Fatalf("node order differs at %d: %v vs %v", i, as.nStr, bs.nStr)
+		}
+	}
+	for _, k := range keys {
+		if got, want := b.Lookup(k), a.Lookup(k); got != want {
+			t.Errorf("Lookup(%q) = %q, want %q", k, got, want)
+		}
+	}
+}
+
+func TestLookupStrict(t *testing.T) {
+	r := New([]string{"a", "b", "c"}, hashFunc)
+
+	tests := []struct {
+		name    string
+		r       *Rendezvous
+		k       string
+		wantErr error
+	}{
+		{name: "empty key", r: r, k: "", wantErr: ErrEmptyKey},
+		{name: "whitespace key", r: r, k: " \t\n", wantErr: ErrEmptyKey},
+		{name: "no nodes", r: New(nil, hashFunc), k: "key", wantErr: ErrNoNodes},
+		{name: "normal case", r: r, k: "key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.r.LookupStrict(tt.k)
+			if err != tt.wantErr {
+				t.Fatalf("LookupStrict(%q) error = %v, want %v", tt.k, err, tt.wantErr)
+			}
+			if err == nil && got != tt.r.Lookup(tt.k) {
+				t.Errorf("LookupStrict(%q) = %q, want %q", tt.k, got, tt.r.Lookup(tt.k))
+			}
+		})
+	}
+}
+
+func TestConcurrentLookup(t *testing.T) {
+	r := New([]string{"a", "b", "c"}, hashFunc)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if n := r.Lookup("key-" + strconv.Itoa(j)); n == "" {
+					t.Errorf("Lookup returned no node")
+					return
+				}
+			}
+		}(i)
+	}
+	for j := 0; j < 100; j++ {
+		node := "node-" + strconv.Itoa(j)
+		r.Add(node)
+		r.Remove(node)
+	}
+	wg.Wait()
+}
+
+func BenchmarkLookupParallel(b *testing.B) {
+	nodes := make([]string, 100)
+	for i := range nodes {
+		nodes[i] = "node-" + strconv.Itoa(i)
+	}
+	r := New(nodes, hashFunc)
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r.Lookup("Hello World!")
+		}
+	})
+}
+
+func TestLookupBoundaries(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes []string
+		n     int
+		want  []string
+	}{
+		{name: "no nodes", nodes: nil, n: 2, want: nil},
+		{name: "one node", nodes: []string{"a"}, n: 2, want: []string{"a"}},
+		{name: "one node, exact n", nodes: []string{"a"}, n: 1, want: []string{"a"}},
+		{name: "zero n", nodes: []string{"a", "b"}, n: 0, want: nil},
+		{name: "negative n", nodes: []string{"a", "b"}, n: -1, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New(tt.nodes, hashFunc)
+			got := r.LookupN("Hello World!", tt.n)
+			if len(got) != len(tt.want) {
+				t.Fatalf("LookupN() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("LookupN() = %v, want %v", got, tt.want)
+				}
+			}
+
+			want := ""
+			if len(tt.nodes) > 0 {
+				want = tt.nodes[0]
+			}
+			if got := r.Lookup("Hello World!"); len(tt.nodes) <= 1 && got != want {
+				t.Errorf("Lookup() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestLookupN(t *testing.T) {
+	r := New([]string{"a", "b", "c", "d", "e"}, hashFunc)
+	for i := 0; i < 100; i++ {
+		k := "key-" + strconv.Itoa(i)
+		got := r.LookupN(k, 3)
+		if len(got) != 3 {
+			t.Fatalf("LookupN(%q, 3) returned %d nodes", k, len(got))
+		}
+		if got[0] != r.Lookup(k) {
+			t.Errorf("LookupN(%q, 3)[0] = %q, want Lookup() = %q", k, got[0], r.Lookup(k))
+		}
+		if got[0] == got[1] || got[1] == got[2] || got[0] == got[2] {
+			t.Errorf("LookupN(%q, 3) returned duplicates: %v", k, got)
+		}
+	}
+}
+
+func TestLookupExplain(t *testing.T) {
+	lenHash := func(s string) uint64 { return uint64(len(s)) }
+	r := New([]string{"a", "bb"}, lenHash)
+	lines := []string{
+		fmt.Sprintf("a hash 0x0000000000000001 score 0x%016x", xorShiftMul64(3^1)),
+		fmt.Sprintf("bb hash 0x0000000000000002 score 0x%016x", xorShiftMul64(3^2)),
+	}
+	if xorShiftMul64(3^2) > xorShiftMul64(3^1) {
+		lines[0], lines[1] = lines[1], lines[0]
+	}
+	want := "key \"xyz\" hash 0x0000000000000003\n1. " + lines[0] + " (winner)\n2. " + lines[1] + "\n"
+	if got := r.LookupExplain("xyz"); got != want {
+		t.Errorf("LookupExplain() =\n%s\nwant\n%s", got, want)
+	}
+
+	r = New([]string{"a", "b", "c"}, hashFunc)
+	for i := 0; i < 100; i++ {
+		k := "key-" + strconv.Itoa(i)
+		if !strings.Contains(r.LookupExplain(k), "1. "+r.Lookup(k)+" ") {
+			t.Fatalf("LookupExplain(%q) does not rank the winner %s first:\n%s", k, r.Lookup(k), r.LookupExplain(k))
+		}
+	}
+	if got := New(nil, hashFunc).LookupExplain("k"); !strings.HasSuffix(got, "no nodes\n") {
+		t.Errorf("LookupExplain() with no nodes = %q", got)
+	}
+}
+
+func TestRank(t *testing.T) {
+	if got := New(nil, hashFunc).Rank("key"); got != nil {
+		t.Errorf("Rank() with no nodes = %v, want nil", got)
+	}
+
+	nodes := []string{"a", "b", "c", "d", "e"}
+	r := New(nodes, hashFunc)
+	for i := 0; i < 100; i++ {
+		k := "key-" + strconv.Itoa(i)
+		ranked := r.Rank(k)
+		if len(ranked) != len(nodes) {
+			t.Fatalf("Rank(%q) returned %d nodes, want %d", k, len(ranked), len(nodes))
+		}
+		for j := 1; j < len(ranked); j++ {
+			prev, _ := r.NodeHash(ranked[j-1])
+			cur, _ := r.NodeHash(ranked[j])
+			if xorShiftMul64(hashFunc(k)^prev) < xorShiftMul64(hashFunc(k)^cur) {
+				t.Fatalf("Rank(%q) = %v is not in descending score order", k, ranked)
+			}
+		}
+		if !reflect.DeepEqual(r.LookupN(k, 3), ranked[:3]) {
+			t.Errorf("LookupN(%q, 3) = %v, want prefix of Rank() %v", k, r.LookupN(k, 3), ranked)
+		}
+	}
+}
+
+func TestLookupExcluding(t *testing.T) {
+	r := New([]string{"a", "b", "c", "d", "e"}, hashFunc)
+	for i := 0; i < 100; i++ {
+		k := "key-" + strconv.Itoa(i)
+		ranked := r.LookupN(k, 3)
+
+		if got := r.LookupExcluding(k, nil); got != ranked[0] {
+			t.Errorf("LookupExcluding(%q, nil) = %q, want %q", k, got, ranked[0])
+		}
+		if got := r.LookupExcluding(k, map[string]bool{ranked[0]: true}); got != ranked[1] {
+			t.Errorf("LookupExcluding(%q) without winner = %q, want runner-up %q", k, got, ranked[1])
+		}
+		if got := r.LookupExcluding(k, map[string]bool{ranked[0]: true, ranked[1]: true}); got != ranked[2] {
+			t.Errorf("LookupExcluding(%q) without top two = %q, want %q", k, got, ranked[2])
+		}
+	}
+
+	all := map[string]bool{"a": true, "b": true, "c": true, "d": true, "e": true}
+	if got := r.LookupExcluding("key", all); got != "" {
+		t.Errorf("LookupExcluding() with every node excluded = %q, want empty", got)
+	}
+}
+
+func TestLookupFailover(t *testing.T) {
+	nodes := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	priority := map[string]int{"a": 1, "b": 5, "c": 2, "d": 5, "e": 3, "f": 0, "g": 4, "h": 1}
+	r := New(nodes, hashFunc)
+
+	if got := r.LookupFailover("key", 0); got != nil {
+		t.Errorf("LookupFailover() with depth 0 = %v, want nil", got)
+	}
+	for i := 0; i < 100; i++ {
+		k := "key-" + strconv.Itoa(i)
+		if got, want := r.LookupFailover(k, 3), r.LookupN(k, 3); !reflect.DeepEqual(got, want) {
+			t.Fatalf("LookupFailover(%q) without Priority = %v, want %v", k, got, want)
+		}
+	}
+
+	r.Priority = func(node string) int { return priority[node] }
+	st := r.state.Load()
+	for i := 0; i < 1000; i++ {
+		k := "key-" + strconv.Itoa(i)
+		got := r.LookupFailover(k, 20)
+		if len(got) != len(nodes) || got[0] != r.Lookup(k) {
+			t.Fatalf("LookupFailover(%q) = %v, want all nodes starting with %q", k, got, r.Lookup(k))
+		}
+		for j := 2; j < len(got); j++ {
+			prev, next := st.score(st.nodes[got[j-1]], hashFunc(k)), st.score(st.nodes[got[j]], hashFunc(k))
+			bandPrev, bandNext := prev>>failoverBandShift, next>>failoverBandShift
+			switch {
+			case bandPrev < bandNext,
+				bandPrev == bandNext && priority[got[j-1]] < priority[got[j]],
+				bandPrev == bandNext && priority[got[j-1]] == priority[got[j]] && prev < next:
+				t.Fatalf("LookupFailover(%q) = %v: %s before %s", k, got, got[j-1], got[j])
+			}
+		}
+	}
+
+	// With every score equal, the primary is the tie-break winner and the
+	// rest follow by priority.
+	r = New(nodes, func(string) uint64 { return 42 })
+	r.Priority = func(node string) int { return priority[node] }
+	if got, want := r.LookupFailover("key", 5), []string{"a", "b", "d", "g", "e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LookupFailover() on a tie = %v, want %v", got, want)
+	}
+}
+
+func TestTieBreak(t *testing.T) {
+	// Every node hashes the same, so every key is a tie between all nodes.
+	constHash := func(string) uint64 { return 42 }
+	r := New([]string{"a", "b", "c"}, constHash)
+	if got := r.Lookup("key"); got != "a" {
+		t.Errorf("Lookup() on a tie = %q, want lexically smallest %q", got, "a")
+	}
+
+	latency := map[string]int{"a": 30, "b": 10, "c": 20}
+	r.TieBreak = func(a, b string) bool { return latency[a] < latency[b] }
+	if got := r.Lookup("key"); got != "b" {
+		t.Errorf("Lookup() with TieBreak = %q, want lowest latency %q", got, "b")
+	}
+	if got := r.LookupIndex("key"); got != 1 {
+		t.Errorf("LookupIndex() with TieBreak = %d, want 1", got)
+	}
+	if got := r.LookupExcluding("key", map[string]bool{"b": true}); got != "c" {
+		t.Errorf("LookupExcluding() with TieBreak = %q, want %q", got, "c")
+	}
+	if got := r.LookupN("key", 3); !reflect.DeepEqual(got, []string{"b", "c", "a"}) {
+		t.Errorf("LookupN() with TieBreak = %v, want [b c a]", got)
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes []string
+		want  string
+	}{
+		{name: "no nodes", nodes: nil, want: `{"nodes":[]}`},
+		{name: "sorted nodes", nodes: []string{"c", "a", "b"}, want: `{"nodes":["a","b","c"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(New(tt.nodes, hashFunc))
+			if err != nil {
+				t.Fatalf("json.Marshal() returned error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("json.Marshal() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddAllRemoveAll(t *testing.T) {
+	r := New([]string{"b", "d"}, hashFunc)
+
+	r.AddAll([]string{"a", "b", "c", "a", "e"})
+	assertNodes(t, r, []string{"a", "b", "c", "d", "e"})
+
+	r.RemoveAll([]string{"b", "x", "e", "b"})
+	assertNodes(t, r, []string{"a", "c", "d"})
+
+	r.AddAll(nil)
+	r.RemoveAll([]string{"x", "y"})
+	assertNodes(t, r, []string{"a", "c", "d"})
+
+	want := New([]string{"a", "c", "d"}, hashFunc)
+	for i := 0; i < 100; i++ {
+		k := "key-" + strconv.Itoa(i)
+		if got := r.Lookup(k); got != want.Lookup(k) {
+			t.Errorf("Lookup(%q) = %q, want %q", k, got, want.Lookup(k))
+		}
+	}
+}
+
+// assertNodes checks that the snapshot holds exactly want, in order, with
+// consistent hashes and index map.
+func assertNodes(t *testing.T, r *Rendezvous, want []string) {
+	t.Helper()
+
+	st := r.state.Load()
+	if len(st.nStr) != len(want) || len(st.nHash) != len(want) || len(st.nodes) != len(want) {
+		t.Fatalf("got nodes %v (%d hashes, %d indexed), want %v", st.nStr, len(st.nHash), len(st.nodes), want)
+	}
+	for i, n := range want {
+		if st.nStr[i] != n || st.nodes[n] != i || st.nHash[i] != r.hash(n) {
+			t.Fatalf("node %d: got %q (index %d), want %q", i, st.nStr[i], st.nodes[n], n)
+		}
+	}
+}
+
+func TestDistribution(t *testing.T) {
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+
+	if got := New(nil, hashFunc).Distribution(keys); len(got) != 0 {
+		t.Errorf("Distribution() with no nodes = %v, want empty", got)
+	}
+
+	r := New([]string{"a", "b", "c", "d", "e"}, hashFunc)
+	dist := r.Distribution(keys)
+	var total int
+	for node, count := range dist {
+		total += count
+		if count < 1800 || count > 2200 {
+			t.Errorf("node %s got %d keys, want about 2000", node, count)
+		}
+	}
+	if total != len(keys) {
+		t.Errorf("Distribution() counted %d keys, want %d", total, len(keys))
+	}
+	if got := r.Distribution(nil); len(got) != 5 || got["a"] != 0 {
+		t.Errorf("Distribution(nil) = %v, want every node with 0", got)
+	}
+
+	tests := []struct {
+		dist map[string]int
+		want float64
+	}{
+		{nil, 0},
+		{map[string]int{"a": 5}, 0},
+		{map[string]int{"a": 2, "b": 4, "c": 4, "d": 4, "e": 5, "f": 5, "g": 7, "h": 9}, 2},
+	}
+	for _, tt := range tests {
+		if got := StdDev(tt.dist); got != tt.want {
+			t.Errorf("StdDev(%v) = %v, want %v", tt.dist, got, tt.want)
+		}
+	}
+}
+
+func TestBalance(t *testing.T) {
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+	nodes := []string{"a", "b", "c", "d", "e"}
+
+	if got := New(nil, hashFunc).Balance(keys); got != 0 {
+		t.Errorf("Balance() with no nodes = %v, want 0", got)
+	}
+	if got := New(nodes, hashFunc).Balance(nil); got != 0 {
+		t.Errorf("Balance(nil) = %v, want 0", got)
+	}
+	if got := New(nodes, hashFunc).Balance(keys); got > 0.1 {
+		t.Errorf("Balance() = %v, want below 0.1", got)
+	}
+	// Every node hashes the same, so "a" wins every key: counts 10000, 0, 0,
+	// 0, 0 have mean 2000 and standard deviation 4000.
+	if got := New(nodes, func(string) uint64 { return 42 }).Balance(keys); got != 2 {
+		t.Errorf("Balance() with every key on one node = %v, want 2", got)
+	}
+}
+
+func TestNewWithReplicas(t *testing.T) {
+	keys := make([]string, 100000)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+	nodes := []string{"a", "b", "c", "d", "e"}
+
+	plain, single := New(nodes, hashFunc), NewWithReplicas(nodes, hashFunc, 1)
+	for _, k := range keys[:1000] {
+		if plain.Lookup(k) != single.Lookup(k) {
+			t.Fatalf("Lookup(%q) with one replica differs from New", k)
+		}
+	}
+
+	r := NewWithReplicas(nodes, hashFunc, 100)
+	r.Add("f")
+	r.Remove("a")
+	for _, k := range keys[:1000] {
+		// The winner is the node owning the best virtual node.
+		var want string
+		var best uint64
+		for _, n := range r.Nodes() {
+			for i := 0; i < 100; i++ {
+				vnode := n
+				if i > 0 {
+					vnode += "#" + strconv.Itoa(i)
+				}
+				if h := xorShiftMul64(hashFunc(k) ^ hashFunc(vnode)); h > best {
+					want, best = n, h
+				}
+			}
+		}
+		if got := r.Lookup(k); got != want {
+			t.Fatalf("Lookup(%q) = %q, want %q", k, got, want)
+		}
+	}
+
+	// Both modes are balanced to within sampling noise: the standard
+	// deviation of a 1/5 share of 100000 keys is about 126.
+	for _, replicas := range []int{1, 100} {
+		dist := NewWithReplicas(nodes, hashFunc, replicas).Distribution(keys)
+		if sd := StdDev(dist); sd > 400 {
+			t.Errorf("replicas=%d: distribution %v has standard deviation %v", replicas, dist, sd)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	r := NewWeighted(map[string]float64{"a": 1, "b": 2, "c": 1}, hashFunc)
+	clone := r.Clone()
+	assertNodes(t, clone, []string{"a", "b", "c"})
+
+	clone.Add("d")
+	clone.Remove("a")
+	assertNodes(t, r, []string{"a", "b", "c"})
+	assertNodes(t, clone, []string{"b", "c", "d"})
+
+	orig, cp := r.state.Load(), clone.state.Load()
+	if &orig.nStr[0] == &cp.nStr[0] || &orig.nHash[0] == &cp.nHash[0] {
+		t.Error("Clone() shares backing slices with the original")
+	}
+
+	for i := 0; i < 1000; i++ {
+		k := "key-" + strconv.Itoa(i)
+		if got := r.Clone().LookupWeighted(k); got != r.LookupWeighted(k) {
+			t.Fatalf("LookupWeighted(%q) on clone = %q, want %q", k, got, r.LookupWeighted(k))
+		}
+		if got := clone.Lookup(k); got == "a" {
+			t.Fatalf("Lookup(%q) on clone routed to removed node", k)
+		}
+	}
+}
+
+func TestAddRemoveStress(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	r := New(nil, hashFunc)
+	present := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		node := "node-" + strconv.Itoa(rnd.Intn(50))
+		if rnd.Intn(2) == 0 {
+			r.Add(node)
+			present[node] = true
+		} else {
+			r.Remove(node)
+			delete(present, node)
+		}
+
+		want := make([]string, 0, len(present))
+		for n := range present {
+			want = append(want, n)
+		}
+		sort.Strings(want)
+		assertNodes(t, r, want)
+		if got := r.Nodes(); len(got) != len(want) {
+			t.Fatalf("op %d: Nodes() = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestNodeHash(t *testing.T) {
+	r := New([]string{"a", "b"}, hashFunc)
+	r.Add("c")
+	r.Remove("a")
+
+	for _, n := range []string{"b", "c"} {
+		h, ok := r.NodeHash(n)
+		if !ok || h != hashFunc(n) {
+			t.Errorf("NodeHash(%q) = %d, %v, want %d, true", n, h, ok, hashFunc(n))
+		}
+	}
+	if _, ok := r.NodeHash("a"); ok {
+		t.Errorf("NodeHash() reported a removed node")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	r := New([]string{"c", "a", "b"}, hashFunc)
+	nodes, hashes := r.Snapshot()
+	if !reflect.DeepEqual(nodes, []string{"a", "b", "c"}) || len(hashes) != 3 {
+		t.Fatalf("Snapshot() = %v, %v", nodes, hashes)
+	}
+	nodes[0], hashes[0] = "changed", 0
+	if n, h := r.Snapshot(); n[0] != "a" || h[0] != hashFunc("a") {
+		t.Errorf("Snapshot() returned shared state")
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			node := "n" + strconv.Itoa(i%10)
+			r.Add(node)
+			r.Remove(node)
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		nodes, hashes := r.Snapshot()
+		if len(nodes) != len(hashes) {
+			t.Fatalf("Snapshot() returned %d nodes and %d hashes", len(nodes), len(hashes))
+		}
+		for j, n := range nodes {
+			if hashes[j] != hashFunc(n) {
+				t.Fatalf("Snapshot() hash of %q = %d, want %d", n, hashes[j], hashFunc(n))
+			}
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestRemoveIndex(t *testing.T) {
+	r := New([]string{"d", "b", "a", "c"}, hashFunc)
+	for _, i := range []int{-1, 4} {
+		if node, ok := r.RemoveIndex(i); ok || node != "" {
+			t.Errorf("RemoveIndex(%d) = %q, %v, want \"\", false", i, node, ok)
+		}
+	}
+
+	k := "key"
+	winner := r.Lookup(k)
+	node, ok := r.RemoveIndex(r.LookupIndex(k))
+	if !ok || node != winner {
+		t.Fatalf("RemoveIndex(LookupIndex()) = %q, %v, want %q, true", node, ok, winner)
+	}
+
+	want := New([]string{"d", "b", "a", "c"}, hashFunc)
+	want.Remove(winner)
+	if !reflect.DeepEqual(r.Nodes(), want.Nodes()) {
+		t.Fatalf("Nodes() after RemoveIndex = %v, want %v", r.Nodes(), want.Nodes())
+	}
+	for i := 0; i < 100; i++ {
+		k := "key-" + strconv.Itoa(i)
+		if got, w := r.LookupIndex(k), want.LookupIndex(k); got != w {
+			t.Fatalf("LookupIndex(%q) after RemoveIndex = %d, want %d", k, got, w)
+		}
+		if r.Lookup(k) == winner {
+			t.Fatalf("Lookup(%q) returned removed node %q", k, winner)
+		}
+	}
+}
+
+func TestLookupIndex(t *testing.T) {
+	r := New(nil, hashFunc)
+	if got := r.LookupIndex("key"); got != -1 {
+		t.Fatalf("LookupIndex() with no nodes = %d, want -1", got)
+	}
+
+	r = New([]string{"d", "b", "a", "c"}, hashFunc)
+	r.Remove("b")
+	r.Add("e")
+	nodes := r.Nodes()
+	for i := 0; i < 100; i++ {
+		k := "key-" + strconv.Itoa(i)
+		idx := r.LookupIndex(k)
+		if idx < 0 || idx >= len(nodes) || nodes[idx] != r.Lookup(k) {
+			t.Fatalf("LookupIndex(%q) = %d, Nodes() = %v, want index of %q", k, idx, nodes, r.Lookup(k))
+		}
+	}
+
+	nodes[0] = "changed"
+	if r.Nodes()[0] == "changed" {
+		t.Errorf("Nodes() returned shared state")
+	}
+}
+
+func TestLookupBytes(t *testing.T) {
+	nodes := []string{"a", "b", "c", "d"}
+	r := New(nodes, hashFunc)
+	rb := NewBytes(nodes, hashBytesFunc)
+
+	if got := NewBytes(nil, hashBytesFunc).LookupBytes([]byte("key")); got != "" {
+		t.Errorf("LookupBytes() with no nodes = %q, want empty", got)
+	}
+	for i := 0; i < 100; i++ {
+		k := "key-" + strconv.Itoa(i)
+		want := r.Lookup(k)
+		if got := r.LookupBytes([]byte(k)); got != want {
+			t.Errorf("LookupBytes(%q) = %q, want %q", k, got, want)
+		}
+		if got := rb.LookupBytes([]byte(k)); got != want {
+			t.Errorf("NewBytes: LookupBytes(%q) = %q, want %q", k, got, want)
+		}
+		if got := rb.Lookup(k); got != want {
+			t.Errorf("NewBytes: Lookup(%q) = %q, want %q", k, got, want)
+		}
+	}
+}
+
+type sum64Hasher struct{}
+
+func (sum64Hasher) Sum64(b []byte) uint64 {
+	return hashBytesFunc(b)
+}
+
+func TestNewFromSum64(t *testing.T) {
+	nodes := []string{"a", "b", "c", "d"}
+	r := New(nodes, hashFunc)
+	rs := NewFromSum64(nodes, sum64Hasher{})
+
+	for i := 0; i < 100; i++ {
+		k := "key-" + strconv.Itoa(i)
+		want := r.Lookup(k)
+		if got := rs.Lookup(k); got != want {
+			t.Errorf("NewFromSum64: Lookup(%q) = %q, want %q", k, got, want)
+		}
+		if got := rs.LookupBytes([]byte(k)); got != want {
+			t.Errorf("NewFromSum64: LookupBytes(%q) = %q, want %q", k, got, want)
+		}
+	}
+}
+
+func BenchmarkLookupBytes(b *testing.B) {
+	r := NewBytes([]string{"a", "b", "c", "d"}, func(b []byte) uint64 {
+		// Allocation-free FNV-1a.
+		h := uint64(14695981039346656037)
+		for _, c := range b {
+			h ^= uint64(c)
+			h *= 1099511628211
+		}
+		return h
+	})
+	key := []byte("Hello World!")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.LookupBytes(key)
+	}
+}
@@ -0,0 +1,92 @@
+package rendezvous
+
+import (
+	"fmt"
+	"math"
+)
+
+// NewWeighted creates a Rendezvous whose nodes have relative weights, for use
+// with LookupWeighted. It panics if a weight is not positive.
+func NewWeighted(nodes map[string]float64, hash HashFunc) *Rendezvous {
+	checkWeights(nodes)
+	return newWeighted(&Rendezvous{hash: hash}, nodes)
+}
+
+// checkWeights panics on a weight that is not positive (or NaN): a negative
+// weight would win every key and a zero one divides by zero.
+func checkWeights(nodes map[string]float64) {
+	for node, weight := range nodes {
+		checkWeight(node, weight)
+	}
+}
+
+func checkWeight(node string, weight float64) {
+	if !(weight > 0) {
+		panic(fmt.Sprintf("rendezvous: weight %v of node %q is not positive", weight, node))
+	}
+}
+
+// ReplicasPerWeight is the number of virtual nodes NewWeightedReplicas gives
+// a node per unit of weight.
+const ReplicasPerWeight = 100
+
+// NewWeightedReplicas creates a Rendezvous where weights are expressed with
+// virtual nodes instead of the logarithmic scoring of LookupWeighted: a node
+// of weight w gets round(w*ReplicasPerWeight) virtual nodes, at least one, and
+// wins a key with its best virtual node. Lookup then gives each node a share
+// of keys proportional to its virtual node count. Weights should be at least
+// 1/ReplicasPerWeight, and LookupWeighted behaves like Lookup. AddWeighted
+// works the same way on the returned Rendezvous. It panics if a weight is not
+// positive.
+func NewWeightedReplicas(nodes map[string]float64, hash HashFunc) *Rendezvous {
+	checkWeights(nodes)
+	return newWeighted(&Rendezvous{hash: hash, weightReplicas: true}, nodes)
+}
+
+// AddWeighted inserts node with the given positive weight. Adding a node that
+// is already present is a no-op. It panics if weight is not positive, like
+// NewWeighted.
+func (r *Rendezvous) AddWeighted(node string, weight float64) {
+	checkWeight(node, weight)
+	r.add(node, weight)
+}
+
+// LookupWeighted returns the node for k using weighted rendezvous hashing: each
+// node scores -weight/ln(u), where u in (0, 1) is derived from the node and
+// key hashes, and the highest score wins. A node therefore receives a share
+// of keys proportional to its weight. It returns "" when there are no nodes.
+//
+// Maximizing -weight/ln(u) is the same as minimizing -ln(u)/weight, so the
+// loop compares ln(u) * (1/weight) with the reciprocal weights precomputed
+// when nodes are added. When all weights are equal the weights cannot change
+// the outcome's distribution, and LookupWeighted returns exactly Lookup(k)
+// without computing any logarithm.
+func (r *Rendezvous) LookupWeighted(k string) string {
+	st := r.state.Load()
+	if len(st.nodes) == 0 {
+		return ""
+	}
+
+	kHash := r.hash(k)
+	if st.uniform {
+		return st.lookup(kHash, r.TieBreak)
+	}
+
+	var mIdx int
+	var mScore = math.Log(unitFloat(st.score(0, kHash))) * st.nInvW[0]
+
+	// Ties are broken as in Lookup.
+	for i := 1; i < len(st.nHash); i++ {
+		if score := math.Log(unitFloat(st.score(i, kHash))) * st.nInvW[i]; score > mScore || score == mScore && st.wins(i, mIdx, r.TieBreak) {
+			mIdx = i
+			mScore = score
+		}
+	}
+
+	return st.nStr[mIdx]
+}
+
+// unitFloat maps a hash to a float64 in the open interval (0, 1).
+func unitFloat(h uint64) float64 {
+	return (float64(h>>11) + 0.5) / (1 << 53)
+}
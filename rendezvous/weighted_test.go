@@ -0,0 +1,168 @@
+package rendezvous
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+// lookupWeightedNaive evaluates the textbook -weight/ln(u) score for every
+// node.
+func lookupWeightedNaive(r *Rendezvous, k string) string {
+	st := r.state.Load()
+	kHash := r.hash(k)
+
+	var best string
+	var bestScore = math.Inf(-1)
+	for i, nHash := range st.nHash {
+		score := -st.nWeight[i] / math.Log(unitFloat(xorShiftMul64(kHash^nHash)))
+		if score > bestScore {
+			best = st.nStr[i]
+			bestScore = score
+		}
+	}
+	return best
+}
+
+func TestLookupWeighted(t *testing.T) {
+	r := NewWeighted(map[string]float64{"a": 1, "b": 2, "c": 3, "d": 4}, hashFunc)
+
+	counts := make(map[string]int)
+	const keyCount = 100000
+	for i := 0; i < keyCount; i++ {
+		k := "key-" + strconv.Itoa(i)
+		got := r.LookupWeighted(k)
+		if want := lookupWeightedNaive(r, k); got != want {
+			t.Fatalf("LookupWeighted(%q) = %q, naive formula gives %q", k, got, want)
+		}
+		counts[got]++
+	}
+
+	for node, weight := range map[string]float64{"a": 1, "b": 2, "c": 3, "d": 4} {
+		want := keyCount * weight / 10
+		if math.Abs(float64(counts[node])-want) > 0.05*want {
+			t.Errorf("node %s got %d keys, want about %v", node, counts[node], want)
+		}
+	}
+
+	if got := NewWeighted(nil, hashFunc).LookupWeighted("key"); got != "" {
+		t.Errorf("LookupWeighted() on no nodes = %q, want empty", got)
+	}
+}
+
+func TestAddWeighted(t *testing.T) {
+	r := NewWeighted(map[string]float64{"a": 1}, hashFunc)
+	r.AddWeighted("b", 3)
+	r.Remove("a")
+	r.AddWeighted("a", 1)
+
+	want := NewWeighted(map[string]float64{"a": 1, "b": 3}, hashFunc)
+	for i := 0; i < 1000; i++ {
+		k := "key-" + strconv.Itoa(i)
+		if got := r.LookupWeighted(k); got != want.LookupWeighted(k) {
+			t.Fatalf("LookupWeighted(%q) = %q, want %q", k, got, want.LookupWeighted(k))
+		}
+	}
+}
+
+func TestNonPositiveWeights(t *testing.T) {
+	for _, w := range []float64{0, -1, math.NaN()} {
+		for name, newFunc := range map[string]func(map[string]float64, HashFunc) *Rendezvous{
+			"NewWeighted":         NewWeighted,
+			"NewWeightedReplicas": NewWeightedReplicas,
+		} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("%s with weight %v did not panic", name, w)
+					}
+				}()
+				newFunc(map[string]float64{"a": 1, "b": w}, hashFunc)
+			}()
+		}
+
+		r := NewWeighted(map[string]float64{"a": 1}, hashFunc)
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("AddWeighted with weight %v did not panic", w)
+				}
+			}()
+			r.AddWeighted("b", w)
+		}()
+		if nodes := r.Nodes(); len(nodes) != 1 {
+			t.Errorf("AddWeighted() with weight %v added a node: %v", w, nodes)
+		}
+	}
+}
+
+func TestNewWeightedReplicas(t *testing.T) {
+	weights := map[string]float64{"a": 1, "b": 2, "c": 3, "d": 0.5}
+	r := NewWeightedReplicas(map[string]float64{"a": 1, "b": 2, "c": 3}, hashFunc)
+	r.AddWeighted("d", 0.5)
+
+	counts := make(map[string]int)
+	const keyCount = 100000
+	for i := 0; i < keyCount; i++ {
+		k := "key-" + strconv.Itoa(i)
+		got := r.Lookup(k)
+		if w := r.LookupWeighted(k); w != got {
+			t.Fatalf("LookupWeighted(%q) = %q, want Lookup() = %q", k, w, got)
+		}
+		counts[got]++
+	}
+
+	for node, weight := range weights {
+		want := keyCount * weight / 6.5
+		if math.Abs(float64(counts[node])-want) > 0.05*want {
+			t.Errorf("node %s got %d keys, want about %v", node, counts[node], want)
+		}
+	}
+}
+
+func TestLookupWeightedUniform(t *testing.T) {
+	nodes := []string{"a", "b", "c", "d", "e"}
+	uniform := New(nodes, hashFunc)
+	weighted := NewWeighted(map[string]float64{"a": 2, "b": 2, "c": 2, "d": 2, "e": 2}, hashFunc)
+
+	for i := 0; i < 10000; i++ {
+		k := "key-" + strconv.Itoa(i)
+		if got, want := weighted.LookupWeighted(k), uniform.Lookup(k); got != want {
+			t.Fatalf("LookupWeighted(%q) with equal weights = %q, want Lookup() = %q", k, got, want)
+		}
+		if got, want := uniform.LookupWeighted(k), uniform.Lookup(k); got != want {
+			t.Fatalf("LookupWeighted(%q) without weights = %q, want Lookup() = %q", k, got, want)
+		}
+	}
+
+	// Unequal weights switch to the weighted formula.
+	weighted.AddWeighted("f", 5)
+	if weighted.state.Load().uniform {
+		t.Fatalf("snapshot with unequal weights marked uniform")
+	}
+	weighted.Remove("f")
+	if !weighted.state.Load().uniform {
+		t.Fatalf("snapshot with equal weights not marked uniform")
+	}
+}
+
+func benchmarkWeighted(b *testing.B, lookup func(r *Rendezvous, k string) string) {
+	nodes := make(map[string]float64, 1000)
+	for i := 0; i < 1000; i++ {
+		nodes["node-"+strconv.Itoa(i)] = float64(i%4 + 1)
+	}
+	r := NewWeighted(nodes, hashFunc)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lookup(r, "Hello World!")
+	}
+}
+
+func BenchmarkLookupWeighted1000(b *testing.B) {
+	benchmarkWeighted(b, (*Rendezvous).LookupWeighted)
+}
+
+func BenchmarkLookupWeightedNaive1000(b *testing.B) {
+	benchmarkWeighted(b, lookupWeightedNaive)
+}